@@ -0,0 +1,84 @@
+package circleci
+
+import (
+	"context"
+	"sync"
+)
+
+// cacheEntry holds a value being read from, or already read from, CircleCI
+type cacheEntry struct {
+	ready chan struct{} // closed once value and err are set
+	value interface{}
+	err   error
+}
+
+// readCache memoizes API reads for the lifetime of the provider, i.e. a single plan,
+// refresh or apply. It is safe for concurrent use, and concurrent reads of the same key
+// share a single request. Writes must invalidate the keys they affect.
+type readCache struct {
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+func newReadCache() *readCache {
+	return &readCache{entries: map[string]*cacheEntry{}}
+}
+
+// get returns the cached value for key, calling read to fill it on a miss
+// Failed reads are not cached
+func (c *readCache) get(ctx context.Context, key string, read func() (interface{}, error)) (interface{}, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cacheEntry{ready: make(chan struct{})}
+		c.entries[key] = entry
+	}
+	c.mutex.Unlock()
+
+	if ok {
+		select {
+		case <-entry.ready:
+			return entry.value, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	entry.value, entry.err = read()
+	close(entry.ready)
+
+	if entry.err != nil {
+		c.invalidateEntry(key, entry)
+	}
+
+	return entry.value, entry.err
+}
+
+// invalidate drops the given keys so the next reads hit the API again
+func (c *readCache) invalidate(keys ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+func (c *readCache) invalidateEntry(key string, entry *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.entries[key] == entry {
+		delete(c.entries, key)
+	}
+}
+
+func envVarsCacheKey(projectName string) string {
+	return "envvars/" + projectName
+}
+
+func projectCacheKey(projectName string) string {
+	return "project/" + projectName
+}
+
+const projectsCacheKey = "projects"
@@ -2,17 +2,21 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -36,25 +40,114 @@ type Logger interface {
 	Printf(fmt string, args ...interface{})
 }
 
+// Sentinel errors matching API errors by status code, use them with errors.Is
+var (
+	ErrNotFound     = errors.New("not found")     // 404
+	ErrUnauthorized = errors.New("unauthorized")  // 401
+	ErrForbidden    = errors.New("forbidden")     // 403
+	ErrConflict     = errors.New("conflict")      // 409
+	ErrRateLimited  = errors.New("rate limited")  // 429
+	ErrGateway      = errors.New("gateway error") // 502, 503 and 504, usually from a proxy or load balancer
+)
+
 // APIError represents an error from CircleCI
 type APIError struct {
 	HTTPStatusCode int
 	Message        string
+	RetryAfter     time.Duration // delay requested by the server through the Retry-After header, if any
+
+	Method string      // method of the failed request
+	Path   string      // path of the failed request, without query parameters
+	Header http.Header // headers of the error response
+	Body   string      // raw error response body with secrets redacted, truncated to maxErrorBodyLength
 }
 
 func (e *APIError) Error() string {
-	return fmt.Sprintf("%d: %s", e.HTTPStatusCode, e.Message)
+	if e.Method == "" {
+		return fmt.Sprintf("%d: %s", e.HTTPStatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s %s: %d: %s", e.Method, e.Path, e.HTTPStatusCode, e.Message)
+}
+
+// Unwrap returns the sentinel error matching the status code, if any
+func (e *APIError) Unwrap() error {
+	switch e.HTTPStatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrGateway
+	}
+	return nil
+}
+
+// Is reports whether the error matches target, either a sentinel error or
+// an *APIError with the same status code
+func (e *APIError) Is(target error) bool {
+	if t, ok := target.(*APIError); ok {
+		return t.HTTPStatusCode == e.HTTPStatusCode
+	}
+	return target != nil && target == e.Unwrap()
+}
+
+// sleep waits for the given duration unless the context is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// IsRetryable reports whether a failed request may succeed if it is sent again
+// Rate limited (429) and server side (5xx) API errors as well as network errors are retryable,
+// any other API error (e.g. 400, 401, 403 or 404) is permanent
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode >= http.StatusInternalServerError
+	}
+
+	// requests aborted by their context must not be sent again
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
 }
 
 // Client is a CircleCI client
 // Its zero value is a usable client for examining public CircleCI repositories
 type Client struct {
-	BaseURL    *url.URL     // CircleCI API endpoint (defaults to DefaultEndpoint)
+	BaseURL    *url.URL     // CircleCI v1.1 API endpoint (defaults to https://circleci.com/api/v1.1/)
 	Token      string       // CircleCI API token (needed for private repositories and mutative actions)
+	TokenQuery bool         // send the token as the circle-token query parameter instead of the Circle-Token header (for older CircleCI Server versions)
 	HTTPClient *http.Client // HTTPClient to use for connecting to CircleCI (defaults to http.DefaultClient)
 
 	Debug  bool   // debug logging enabled
 	Logger Logger // logger to send debug messages on (if enabled), defaults to logging to stderr with the standard flags
+
+	rateLimit rateLimit // quota reported by the X-RateLimit-* headers, used to throttle requests ahead of a 429
 }
 
 func (c *Client) baseURL() *url.URL {
@@ -87,58 +180,101 @@ func (c *Client) debug(format string, args ...interface{}) {
 	}
 }
 
+// debugRequest logs the request with its token, secret headers and secret body fields redacted
 func (c *Client) debugRequest(req *http.Request) {
-	if c.Debug {
-		out, err := httputil.DumpRequestOut(req, true)
-		if err != nil {
-			c.debug("error debugging request %+v: %s", req, err)
+	if !c.Debug {
+		return
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		if reader, err := req.GetBody(); err == nil {
+			body, _ = ioutil.ReadAll(reader)
+			reader.Close()
 		}
-		c.debug("request:\n%+v", string(out))
 	}
+
+	masked := *req
+	masked.Header = redactHeader(req.Header)
+	if u, err := url.Parse(redactURL(req.URL)); err == nil {
+		masked.URL = u
+	}
+
+	out, err := httputil.DumpRequestOut(&masked, false)
+	if err != nil {
+		c.debug("error debugging request %s %s: %s", req.Method, redactURL(req.URL), err)
+		return
+	}
+	c.debug("request:\n%s%s", out, redactBody(body))
 }
 
+// debugResponse logs the response with secret headers and secret body fields redacted
+// The response body is buffered so it can still be read by the caller
 func (c *Client) debugResponse(resp *http.Response) {
-	if c.Debug {
-		out, err := httputil.DumpResponse(resp, true)
-		if err != nil {
-			c.debug("error debugging response %+v: %s", resp, err)
-		}
-		c.debug("response:\n%+v", string(out))
+	if !c.Debug {
+		return
 	}
-}
 
-type nopCloser struct {
-	io.Reader
-}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		c.debug("error debugging response %s: %s", resp.Status, err)
+		return
+	}
 
-func (n nopCloser) Close() error { return nil }
+	masked := *resp
+	masked.Header = redactHeader(resp.Header)
+	masked.Body = nil
+
+	out, err := httputil.DumpResponse(&masked, false)
+	if err != nil {
+		c.debug("error debugging response %s: %s", resp.Status, err)
+		return
+	}
+	c.debug("response:\n%s%s", out, redactBody(body))
+}
 
-func (c *Client) request(method, path string, responseStruct interface{}, params url.Values, bodyStruct interface{}) error {
+func (c *Client) request(ctx context.Context, method, path string, responseStruct interface{}, params url.Values, bodyStruct interface{}) error {
 	if params == nil {
 		params = url.Values{}
 	}
-	params.Add("circle-token", c.Token)
+	if c.TokenQuery && c.Token != "" {
+		params.Add("circle-token", c.Token)
+	}
 
 	u := c.baseURL().ResolveReference(&url.URL{Path: path, RawQuery: params.Encode()})
 
-	c.debug("building request for %s", u)
-
-	req, err := http.NewRequest(method, u.String(), nil)
-	if err != nil {
-		return err
-	}
+	c.debug("building request for %s", redactURL(u))
 
+	var body io.Reader
 	if bodyStruct != nil {
 		b, err := json.Marshal(bodyStruct)
 		if err != nil {
 			return err
 		}
 
-		req.Body = nopCloser{bytes.NewBuffer(b)}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return err
 	}
 
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Content-Type", "application/json")
+	if !c.TokenQuery && c.Token != "" {
+		req.Header.Add("Circle-Token", c.Token)
+	}
+
+	req = req.WithContext(ctx)
+
+	if wait := c.rateLimit.delay(time.Now()); wait > 0 {
+		c.debug("rate limit quota is low, waiting %s before sending request", wait)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
 
 	c.debugRequest(req)
 
@@ -150,27 +286,30 @@ func (c *Client) request(method, path string, responseStruct interface{}, params
 
 	c.debugResponse(resp)
 
+	c.rateLimit.update(resp.Header, time.Now())
+
 	if resp.StatusCode >= 300 {
+		apiErr := &APIError{
+			HTTPStatusCode: resp.StatusCode,
+			RetryAfter:     parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Method:         method,
+			Path:           req.URL.Path,
+			Header:         resp.Header,
+		}
+
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return &APIError{HTTPStatusCode: resp.StatusCode, Message: "unable to parse response: %s"}
+			apiErr.Message = fmt.Sprintf("unable to read response: %s", err)
+			return apiErr
 		}
 
-		if len(body) > 0 {
-			message := struct {
-				Message string `json:"message"`
-			}{}
-			err = json.Unmarshal(body, &message)
-			if err != nil {
-				return &APIError{
-					HTTPStatusCode: resp.StatusCode,
-					Message:        fmt.Sprintf("unable to parse API response: %s", err),
-				}
-			}
-			return &APIError{HTTPStatusCode: resp.StatusCode, Message: message.Message}
+		apiErr.Body = truncate(string(redactBody(body)), maxErrorBodyLength)
+		apiErr.Message = errorMessage(resp.Header.Get("Content-Type"), body)
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
 		}
 
-		return &APIError{HTTPStatusCode: resp.StatusCode}
+		return apiErr
 	}
 
 	if responseStruct != nil {
@@ -185,9 +324,14 @@ func (c *Client) request(method, path string, responseStruct interface{}, params
 
 // Me returns information about the current user
 func (c *Client) Me() (*User, error) {
+	return c.MeWithContext(context.Background())
+}
+
+// MeWithContext is Me with a context bounding the request
+func (c *Client) MeWithContext(ctx context.Context) (*User, error) {
 	user := &User{}
 
-	err := c.request("GET", "me", user, nil, nil)
+	err := c.request(ctx, "GET", "me", user, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -197,9 +341,14 @@ func (c *Client) Me() (*User, error) {
 
 // ListProjects returns the list of projects the user is watching
 func (c *Client) ListProjects() ([]*Project, error) {
+	return c.ListProjectsWithContext(context.Background())
+}
+
+// ListProjectsWithContext is ListProjects with a context bounding the request
+func (c *Client) ListProjectsWithContext(ctx context.Context) ([]*Project, error) {
 	projects := []*Project{}
 
-	err := c.request("GET", "projects", &projects, nil, nil)
+	err := c.request(ctx, "GET", "projects", &projects, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -210,37 +359,105 @@ func (c *Client) ListProjects() ([]*Project, error) {
 // EnableProject enables a project - generates a deploy SSH key used to checkout the Github repo.
 // The Github user tied to the Circle API Token must have "admin" access to the repo.
 func (c *Client) EnableProject(vcsType, account, repo string) error {
-	return c.request("POST", fmt.Sprintf("project/%s/%s/%s/enable", vcsType, account, repo), nil, nil, nil)
+	return c.EnableProjectWithContext(context.Background(), vcsType, account, repo)
+}
+
+// EnableProjectWithContext is EnableProject with a context bounding the request
+func (c *Client) EnableProjectWithContext(ctx context.Context, vcsType, account, repo string) error {
+	return c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/enable", vcsType, account, repo), nil, nil, nil)
 }
 
 // DisableProject disables a project
 func (c *Client) DisableProject(vcsType, account, repo string) error {
-	return c.request("DELETE", fmt.Sprintf("project/%s/%s/%s/enable", vcsType, account, repo), nil, nil, nil)
+	return c.DisableProjectWithContext(context.Background(), vcsType, account, repo)
+}
+
+// DisableProjectWithContext is DisableProject with a context bounding the request
+func (c *Client) DisableProjectWithContext(ctx context.Context, vcsType, account, repo string) error {
+	return c.request(ctx, "DELETE", fmt.Sprintf("project/%s/%s/%s/enable", vcsType, account, repo), nil, nil, nil)
 }
 
 // FollowProject follows a project
 func (c *Client) FollowProject(vcsType, account, repo string) (*Project, error) {
+	return c.FollowProjectWithContext(context.Background(), vcsType, account, repo)
+}
+
+// FollowProjectWithContext is FollowProject with a context bounding the request
+func (c *Client) FollowProjectWithContext(ctx context.Context, vcsType, account, repo string) (*Project, error) {
+
+	project := &Project{}
 
+	err := c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/follow", vcsType, account, repo), project, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+// GetProject retrieves a specific project through its settings endpoint
+// Returns nil if the project does not exist or is not visible to the API token.
+// CircleCI installations without that endpoint are served from the list of watched projects
+func (c *Client) GetProject(vcsType, account, repo string) (*Project, error) {
+	return c.GetProjectWithContext(context.Background(), vcsType, account, repo)
+}
+
+// GetProjectWithContext is GetProject with a context bounding the request
+func (c *Client) GetProjectWithContext(ctx context.Context, vcsType, account, repo string) (*Project, error) {
+	project, err := c.GetProjectSettingsWithContext(ctx, vcsType, account, repo)
+	if !ProjectSettingsUnavailable(err) {
+		return project, err
+	}
+
+	c.debug("project settings lookup failed (%s), looking for the project in the list of watched projects", err)
+	project, err = c.findWatchedProject(ctx, vcsType, account, repo)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return project, err
+}
+
+// ProjectSettingsUnavailable reports whether a failed project settings lookup is to be answered
+// from the list of watched projects instead. CircleCI Server installations without the settings
+// endpoint answer 404, like projects which do not exist, or another permanent API error
+func ProjectSettingsUnavailable(err error) bool {
+	var apiErr *APIError
+	if err == nil || !errors.As(err, &apiErr) {
+		return false
+	}
+	return !IsRetryable(err) && !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrForbidden)
+}
+
+// GetProjectSettingsWithContext retrieves a specific project through its settings endpoint only,
+// unlike GetProjectWithContext it fails with ErrNotFound if the project does not exist
+func (c *Client) GetProjectSettingsWithContext(ctx context.Context, vcsType, account, repo string) (*Project, error) {
 	project := &Project{}
 
-	err := c.request("POST", fmt.Sprintf("project/%s/%s/%s/follow", vcsType, account, repo), project, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/settings", vcsType, account, repo), project, nil, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	if project.Username == "" {
+		project.Username = account
+	}
+	if project.Reponame == "" {
+		project.Reponame = repo
+	}
+
 	return project, nil
 }
 
-// GetProject retrieves a specific project
-// Returns nil of the project is not in the list of watched projects
-func (c *Client) GetProject(account, repo string) (*Project, error) {
-	projects, err := c.ListProjects()
+// findWatchedProject looks the project up in the list of watched projects
+// Returns nil if the project is not in that list
+func (c *Client) findWatchedProject(ctx context.Context, vcsType, account, repo string) (*Project, error) {
+	projects, err := c.ListProjectsWithContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, project := range projects {
-		if account == project.Username && repo == project.Reponame {
+		if account == project.Username && repo == project.Reponame && project.IsVCSType(vcsType) {
 			return project, nil
 		}
 	}
@@ -248,7 +465,7 @@ func (c *Client) GetProject(account, repo string) (*Project, error) {
 	return nil, nil
 }
 
-func (c *Client) recentBuilds(path string, params url.Values, limit, offset int) ([]*Build, error) {
+func (c *Client) recentBuilds(ctx context.Context, path string, params url.Values, limit, offset int) ([]*Build, error) {
 	allBuilds := []*Build{}
 
 	if params == nil {
@@ -271,7 +488,7 @@ func (c *Client) recentBuilds(path string, params url.Values, limit, offset int)
 		params.Set("limit", strconv.Itoa(l))
 		params.Set("offset", strconv.Itoa(offset))
 
-		err := c.request("GET", path, &builds, params, nil)
+		err := c.request(ctx, "GET", path, &builds, params, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -290,13 +507,23 @@ func (c *Client) recentBuilds(path string, params url.Values, limit, offset int)
 // ListRecentBuilds fetches the list of recent builds for all repositories the user is watching
 // If limit is -1, fetches all builds
 func (c *Client) ListRecentBuilds(limit, offset int) ([]*Build, error) {
-	return c.recentBuilds("recent-builds", nil, limit, offset)
+	return c.ListRecentBuildsWithContext(context.Background(), limit, offset)
+}
+
+// ListRecentBuildsWithContext is ListRecentBuilds with a context bounding the request
+func (c *Client) ListRecentBuildsWithContext(ctx context.Context, limit, offset int) ([]*Build, error) {
+	return c.recentBuilds(ctx, "recent-builds", nil, limit, offset)
 }
 
 // ListRecentBuildsForProject fetches the list of recent builds for the given repository
 // The status and branch parameters are used to further filter results if non-empty
 // If limit is -1, fetches all builds
 func (c *Client) ListRecentBuildsForProject(vcsType, account, repo, branch, status string, limit, offset int) ([]*Build, error) {
+	return c.ListRecentBuildsForProjectWithContext(context.Background(), vcsType, account, repo, branch, status, limit, offset)
+}
+
+// ListRecentBuildsForProjectWithContext is ListRecentBuildsForProject with a context bounding the request
+func (c *Client) ListRecentBuildsForProjectWithContext(ctx context.Context, vcsType, account, repo, branch, status string, limit, offset int) ([]*Build, error) {
 	path := fmt.Sprintf("project/%s/%s/%s", vcsType, account, repo)
 	if branch != "" {
 		path = fmt.Sprintf("%s/tree/%s", path, branch)
@@ -307,14 +534,19 @@ func (c *Client) ListRecentBuildsForProject(vcsType, account, repo, branch, stat
 		params.Set("filter", status)
 	}
 
-	return c.recentBuilds(path, params, limit, offset)
+	return c.recentBuilds(ctx, path, params, limit, offset)
 }
 
 // GetBuild fetches a given build by number
 func (c *Client) GetBuild(vcsType, account, repo string, buildNum int) (*Build, error) {
+	return c.GetBuildWithContext(context.Background(), vcsType, account, repo, buildNum)
+}
+
+// GetBuildWithContext is GetBuild with a context bounding the request
+func (c *Client) GetBuildWithContext(ctx context.Context, vcsType, account, repo string, buildNum int) (*Build, error) {
 	build := &Build{}
 
-	err := c.request("GET", fmt.Sprintf("project/%s/%s/%s/%d", vcsType, account, repo, buildNum), build, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/%d", vcsType, account, repo, buildNum), build, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -324,9 +556,14 @@ func (c *Client) GetBuild(vcsType, account, repo string, buildNum int) (*Build,
 
 // ListBuildArtifacts fetches the build artifacts for the given build
 func (c *Client) ListBuildArtifacts(vcsType, account, repo string, buildNum int) ([]*Artifact, error) {
+	return c.ListBuildArtifactsWithContext(context.Background(), vcsType, account, repo, buildNum)
+}
+
+// ListBuildArtifactsWithContext is ListBuildArtifacts with a context bounding the request
+func (c *Client) ListBuildArtifactsWithContext(ctx context.Context, vcsType, account, repo string, buildNum int) ([]*Artifact, error) {
 	artifacts := []*Artifact{}
 
-	err := c.request("GET", fmt.Sprintf("project/%s/%s/%s/%d/artifacts", vcsType, account, repo, buildNum), &artifacts, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/%d/artifacts", vcsType, account, repo, buildNum), &artifacts, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -336,11 +573,16 @@ func (c *Client) ListBuildArtifacts(vcsType, account, repo string, buildNum int)
 
 // ListTestMetadata fetches the build metadata for the given build
 func (c *Client) ListTestMetadata(vcsType, account, repo string, buildNum int) ([]*TestMetadata, error) {
+	return c.ListTestMetadataWithContext(context.Background(), vcsType, account, repo, buildNum)
+}
+
+// ListTestMetadataWithContext is ListTestMetadata with a context bounding the request
+func (c *Client) ListTestMetadataWithContext(ctx context.Context, vcsType, account, repo string, buildNum int) ([]*TestMetadata, error) {
 	metadata := struct {
 		Tests []*TestMetadata `json:"tests"`
 	}{}
 
-	err := c.request("GET", fmt.Sprintf("project/%s/%s/%s/%d/tests", vcsType, account, repo, buildNum), &metadata, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/%d/tests", vcsType, account, repo, buildNum), &metadata, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -353,9 +595,14 @@ func (c *Client) ListTestMetadata(vcsType, account, repo string, buildNum int) (
 //
 // The API token being used must be a user API token
 func (c *Client) AddSSHUser(vcsType, account, repo string, buildNum int) (*Build, error) {
+	return c.AddSSHUserWithContext(context.Background(), vcsType, account, repo, buildNum)
+}
+
+// AddSSHUserWithContext is AddSSHUser with a context bounding the request
+func (c *Client) AddSSHUserWithContext(ctx context.Context, vcsType, account, repo string, buildNum int) (*Build, error) {
 	build := &Build{}
 
-	err := c.request("POST", fmt.Sprintf("project/%s/%s/%s/%d/ssh-users", vcsType, account, repo, buildNum), build, nil, nil)
+	err := c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/%d/ssh-users", vcsType, account, repo, buildNum), build, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -366,9 +613,14 @@ func (c *Client) AddSSHUser(vcsType, account, repo string, buildNum int) (*Build
 // Build triggers a new build for the given project on the given branch
 // Returns the new build information
 func (c *Client) Build(vcsType, account, repo, branch string) (*Build, error) {
+	return c.BuildWithContext(context.Background(), vcsType, account, repo, branch)
+}
+
+// BuildWithContext is Build with a context bounding the request
+func (c *Client) BuildWithContext(ctx context.Context, vcsType, account, repo, branch string) (*Build, error) {
 	build := &Build{}
 
-	err := c.request("POST", fmt.Sprintf("project/%s/%s/%s/tree/%s", vcsType, account, repo, branch), build, nil, nil)
+	err := c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/tree/%s", vcsType, account, repo, branch), build, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -379,9 +631,14 @@ func (c *Client) Build(vcsType, account, repo, branch string) (*Build, error) {
 // RetryBuild triggers a retry of the specified build
 // Returns the new build information
 func (c *Client) RetryBuild(vcsType, account, repo string, buildNum int) (*Build, error) {
+	return c.RetryBuildWithContext(context.Background(), vcsType, account, repo, buildNum)
+}
+
+// RetryBuildWithContext is RetryBuild with a context bounding the request
+func (c *Client) RetryBuildWithContext(ctx context.Context, vcsType, account, repo string, buildNum int) (*Build, error) {
 	build := &Build{}
 
-	err := c.request("POST", fmt.Sprintf("project/%s/%s/%s/%d/retry", vcsType, account, repo, buildNum), build, nil, nil)
+	err := c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/%d/retry", vcsType, account, repo, buildNum), build, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -392,9 +649,14 @@ func (c *Client) RetryBuild(vcsType, account, repo string, buildNum int) (*Build
 // CancelBuild triggers a cancel of the specified build
 // Returns the new build information
 func (c *Client) CancelBuild(vcsType, account, repo string, buildNum int) (*Build, error) {
+	return c.CancelBuildWithContext(context.Background(), vcsType, account, repo, buildNum)
+}
+
+// CancelBuildWithContext is CancelBuild with a context bounding the request
+func (c *Client) CancelBuildWithContext(ctx context.Context, vcsType, account, repo string, buildNum int) (*Build, error) {
 	build := &Build{}
 
-	err := c.request("POST", fmt.Sprintf("project/%s/%s/%s/%d/cancel", vcsType, account, repo, buildNum), build, nil, nil)
+	err := c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/%d/cancel", vcsType, account, repo, buildNum), build, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -405,11 +667,16 @@ func (c *Client) CancelBuild(vcsType, account, repo string, buildNum int) (*Buil
 // ClearCache clears the cache of the specified project
 // Returns the status returned by CircleCI
 func (c *Client) ClearCache(vcsType, account, repo string) (string, error) {
+	return c.ClearCacheWithContext(context.Background(), vcsType, account, repo)
+}
+
+// ClearCacheWithContext is ClearCache with a context bounding the request
+func (c *Client) ClearCacheWithContext(ctx context.Context, vcsType, account, repo string) (string, error) {
 	status := &struct {
 		Status string `json:"status"`
 	}{}
 
-	err := c.request("DELETE", fmt.Sprintf("project/%s/%s/%s/build-cache", vcsType, account, repo), status, nil, nil)
+	err := c.request(ctx, "DELETE", fmt.Sprintf("project/%s/%s/%s/build-cache", vcsType, account, repo), status, nil, nil)
 	if err != nil {
 		return "", err
 	}
@@ -420,9 +687,14 @@ func (c *Client) ClearCache(vcsType, account, repo string) (string, error) {
 // AddEnvVar adds a new environment variable to the specified project
 // Returns the added env var (the value will be masked)
 func (c *Client) AddEnvVar(vcsType, account, repo, name, value string) (*EnvVar, error) {
+	return c.AddEnvVarWithContext(context.Background(), vcsType, account, repo, name, value)
+}
+
+// AddEnvVarWithContext is AddEnvVar with a context bounding the request
+func (c *Client) AddEnvVarWithContext(ctx context.Context, vcsType, account, repo, name, value string) (*EnvVar, error) {
 	envVar := &EnvVar{}
 
-	err := c.request("POST", fmt.Sprintf("project/%s/%s/%s/envvar", vcsType, account, repo), envVar, nil, &EnvVar{Name: name, Value: value})
+	err := c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/envvar", vcsType, account, repo), envVar, nil, &EnvVar{Name: name, Value: value})
 	if err != nil {
 		return nil, err
 	}
@@ -434,21 +706,19 @@ func (c *Client) AddEnvVar(vcsType, account, repo, name, value string) (*EnvVar,
 // Returns the environment variable (the value will be masked).
 // If an environment variable with that name does not exists, it returns an empty environment variable
 func (c *Client) GetEnvVar(vcsType, account, repo, name string) (*EnvVar, error) {
+	return c.GetEnvVarWithContext(context.Background(), vcsType, account, repo, name)
+}
+
+// GetEnvVarWithContext is GetEnvVar with a context bounding the request
+func (c *Client) GetEnvVarWithContext(ctx context.Context, vcsType, account, repo, name string) (*EnvVar, error) {
 	envVar := EnvVar{}
-	err := c.request("GET", fmt.Sprintf("project/%s/%s/%s/envvar/%s", vcsType, account, repo, name), &envVar, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/envvar/%s", vcsType, account, repo, name), &envVar, nil, nil)
 	if err != nil {
-
-		typedErr, ok := err.(*APIError)
-		if !ok {
-			return nil, err
-		}
-		// if error is 404 and the message is {"message":"env var not found"}
-		// we can assume the environment variable is not found and return an empty structure
-		if typedErr.HTTPStatusCode == 404 && typedErr.Message == "env var not found" {
+		// a 404 means the environment variable (or its project) does not exist
+		if errors.Is(err, ErrNotFound) {
 			return &envVar, nil
 		}
 		return nil, err
-
 	}
 
 	return &envVar, nil
@@ -457,9 +727,14 @@ func (c *Client) GetEnvVar(vcsType, account, repo, name string) (*EnvVar, error)
 // ListEnvVars list environment variable to the specified project
 // Returns the env vars (the value will be masked)
 func (c *Client) ListEnvVars(vcsType, account, repo string) ([]EnvVar, error) {
+	return c.ListEnvVarsWithContext(context.Background(), vcsType, account, repo)
+}
+
+// ListEnvVarsWithContext is ListEnvVars with a context bounding the request
+func (c *Client) ListEnvVarsWithContext(ctx context.Context, vcsType, account, repo string) ([]EnvVar, error) {
 	envVar := []EnvVar{}
 
-	err := c.request("GET", fmt.Sprintf("project/%s/%s/%s/envvar", vcsType, account, repo), &envVar, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/envvar", vcsType, account, repo), &envVar, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -469,30 +744,50 @@ func (c *Client) ListEnvVars(vcsType, account, repo string) ([]EnvVar, error) {
 
 // DeleteEnvVar deletes the specified environment variable from the project
 func (c *Client) DeleteEnvVar(vcsType, account, repo, name string) error {
-	return c.request("DELETE", fmt.Sprintf("project/%s/%s/%s/envvar/%s", vcsType, account, repo, name), nil, nil, nil)
+	return c.DeleteEnvVarWithContext(context.Background(), vcsType, account, repo, name)
+}
+
+// DeleteEnvVarWithContext is DeleteEnvVar with a context bounding the request
+func (c *Client) DeleteEnvVarWithContext(ctx context.Context, vcsType, account, repo, name string) error {
+	return c.request(ctx, "DELETE", fmt.Sprintf("project/%s/%s/%s/envvar/%s", vcsType, account, repo, name), nil, nil, nil)
 }
 
 // AddSSHKey adds a new SSH key to the project
 func (c *Client) AddSSHKey(vcsType, account, repo, hostname, privateKey string) error {
+	return c.AddSSHKeyWithContext(context.Background(), vcsType, account, repo, hostname, privateKey)
+}
+
+// AddSSHKeyWithContext is AddSSHKey with a context bounding the request
+func (c *Client) AddSSHKeyWithContext(ctx context.Context, vcsType, account, repo, hostname, privateKey string) error {
 	key := &struct {
 		Hostname   string `json:"hostname"`
 		PrivateKey string `json:"private_key"`
 	}{hostname, privateKey}
-	return c.request("POST", fmt.Sprintf("project/%s/%s/%s/ssh-key", vcsType, account, repo), nil, nil, key)
+	return c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/ssh-key", vcsType, account, repo), nil, nil, key)
 }
 
 // DeleteSSHKey deletes an SSH key from the project
 func (c *Client) DeleteSSHKey(vcsType, account, repo, hostname, fingerprint string) error {
+	return c.DeleteSSHKeyWithContext(context.Background(), vcsType, account, repo, hostname, fingerprint)
+}
+
+// DeleteSSHKeyWithContext is DeleteSSHKey with a context bounding the request
+func (c *Client) DeleteSSHKeyWithContext(ctx context.Context, vcsType, account, repo, hostname, fingerprint string) error {
 	key := &struct {
 		Hostname    string `json:"hostname"`
 		Fingerprint string `json:"fingerprint"`
 	}{hostname, fingerprint}
-	return c.request("DELETE", fmt.Sprintf("project/%s/%s/%s/ssh-key", vcsType, account, repo), nil, nil, key)
+	return c.request(ctx, "DELETE", fmt.Sprintf("project/%s/%s/%s/ssh-key", vcsType, account, repo), nil, nil, key)
 }
 
 // GetActionOutputs fetches the output for the given action
 // If the action has no output, returns nil
 func (c *Client) GetActionOutputs(a *Action) ([]*Output, error) {
+	return c.GetActionOutputsWithContext(context.Background(), a)
+}
+
+// GetActionOutputsWithContext is GetActionOutputs with a context bounding the request
+func (c *Client) GetActionOutputsWithContext(ctx context.Context, a *Action) ([]*Output, error) {
 	if !a.HasOutput || a.OutputURL == "" {
 		return nil, nil
 	}
@@ -501,6 +796,7 @@ func (c *Client) GetActionOutputs(a *Action) ([]*Output, error) {
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	c.debugRequest(req)
 
@@ -522,9 +818,14 @@ func (c *Client) GetActionOutputs(a *Action) ([]*Output, error) {
 
 // ListCheckoutKeys fetches the checkout keys associated with the given project
 func (c *Client) ListCheckoutKeys(vcsType, account, repo string) ([]*CheckoutKey, error) {
+	return c.ListCheckoutKeysWithContext(context.Background(), vcsType, account, repo)
+}
+
+// ListCheckoutKeysWithContext is ListCheckoutKeys with a context bounding the request
+func (c *Client) ListCheckoutKeysWithContext(ctx context.Context, vcsType, account, repo string) ([]*CheckoutKey, error) {
 	checkoutKeys := []*CheckoutKey{}
 
-	err := c.request("GET", fmt.Sprintf("project/%s/%s/%s/checkout-key", vcsType, account, repo), &checkoutKeys, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/checkout-key", vcsType, account, repo), &checkoutKeys, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -537,13 +838,18 @@ func (c *Client) ListCheckoutKeys(vcsType, account, repo string) ([]*CheckoutKey
 //
 // The github-user-key type requires that the API token being used be a user API token
 func (c *Client) CreateCheckoutKey(vcsType, account, repo, keyType string) (*CheckoutKey, error) {
+	return c.CreateCheckoutKeyWithContext(context.Background(), vcsType, account, repo, keyType)
+}
+
+// CreateCheckoutKeyWithContext is CreateCheckoutKey with a context bounding the request
+func (c *Client) CreateCheckoutKeyWithContext(ctx context.Context, vcsType, account, repo, keyType string) (*CheckoutKey, error) {
 	checkoutKey := &CheckoutKey{}
 
 	body := struct {
 		KeyType string `json:"type"`
 	}{KeyType: keyType}
 
-	err := c.request("POST", fmt.Sprintf("project/%s/%s/%s/checkout-key", vcsType, account, repo), checkoutKey, nil, body)
+	err := c.request(ctx, "POST", fmt.Sprintf("project/%s/%s/%s/checkout-key", vcsType, account, repo), checkoutKey, nil, body)
 	if err != nil {
 		return nil, err
 	}
@@ -553,9 +859,14 @@ func (c *Client) CreateCheckoutKey(vcsType, account, repo, keyType string) (*Che
 
 // GetCheckoutKey fetches the checkout key for the given project by fingerprint
 func (c *Client) GetCheckoutKey(vcsType, account, repo, fingerprint string) (*CheckoutKey, error) {
+	return c.GetCheckoutKeyWithContext(context.Background(), vcsType, account, repo, fingerprint)
+}
+
+// GetCheckoutKeyWithContext is GetCheckoutKey with a context bounding the request
+func (c *Client) GetCheckoutKeyWithContext(ctx context.Context, vcsType, account, repo, fingerprint string) (*CheckoutKey, error) {
 	checkoutKey := &CheckoutKey{}
 
-	err := c.request("GET", fmt.Sprintf("project/%s/%s/%s/checkout-key/%s", vcsType, account, repo, fingerprint), &checkoutKey, nil, nil)
+	err := c.request(ctx, "GET", fmt.Sprintf("project/%s/%s/%s/checkout-key/%s", vcsType, account, repo, fingerprint), &checkoutKey, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -565,7 +876,12 @@ func (c *Client) GetCheckoutKey(vcsType, account, repo, fingerprint string) (*Ch
 
 // DeleteCheckoutKey fetches the checkout key for the given project by fingerprint
 func (c *Client) DeleteCheckoutKey(vcsType, account, repo, fingerprint string) error {
-	return c.request("DELETE", fmt.Sprintf("project/%s/%s/%s/checkout-key/%s", vcsType, account, repo, fingerprint), nil, nil, nil)
+	return c.DeleteCheckoutKeyWithContext(context.Background(), vcsType, account, repo, fingerprint)
+}
+
+// DeleteCheckoutKeyWithContext is DeleteCheckoutKey with a context bounding the request
+func (c *Client) DeleteCheckoutKeyWithContext(ctx context.Context, vcsType, account, repo, fingerprint string) error {
+	return c.request(ctx, "DELETE", fmt.Sprintf("project/%s/%s/%s/checkout-key/%s", vcsType, account, repo, fingerprint), nil, nil, nil)
 }
 
 // AddHerokuKey associates a Heroku key with the user's API token to allow
@@ -576,11 +892,16 @@ func (c *Client) DeleteCheckoutKey(vcsType, account, repo, fingerprint string) e
 // NOTE: It doesn't look like there is currently a way to dissaccociate your
 // Heroku key, so use with care
 func (c *Client) AddHerokuKey(key string) error {
+	return c.AddHerokuKeyWithContext(context.Background(), key)
+}
+
+// AddHerokuKeyWithContext is AddHerokuKey with a context bounding the request
+func (c *Client) AddHerokuKeyWithContext(ctx context.Context, key string) error {
 	body := struct {
 		APIKey string `json:"apikey"`
 	}{APIKey: key}
 
-	return c.request("POST", "/user/heroku-key", nil, nil, body)
+	return c.request(ctx, "POST", "user/heroku-key", nil, nil, body)
 }
 
 // ValidateEnvVarName check an environment variable name is valid according to https://circleci.com/docs/2.0/env-vars/#injecting-environment-variables-with-the-api
@@ -714,6 +1035,25 @@ type Project struct {
 	VCSURL              string            `json:"vcs_url"`
 }
 
+// IsVCSType reports whether the project may be hosted on the given VCS type (github or bitbucket)
+// Only projects whose VCS URL points at the other VCS are rejected, so self-hosted
+// VCS installations and projects without VCS URL match any type
+func (p *Project) IsVCSType(vcsType string) bool {
+	u, err := url.Parse(p.VCSURL)
+	if err != nil {
+		return true
+	}
+	host := strings.ToLower(u.Host)
+
+	switch strings.ToLower(vcsType) {
+	case "github", "gh":
+		return !strings.Contains(host, "bitbucket")
+	case "bitbucket", "bb":
+		return !strings.Contains(host, "github")
+	}
+	return true
+}
+
 // CommitDetails represents information about a commit returned with other
 // structs
 type CommitDetails struct {
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxErrorBodyLength    = 512 // bytes of the raw error body kept on APIError
+	maxErrorMessageLength = 200 // characters of a non JSON error body used as message
+)
+
+var (
+	htmlTitleRE = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlTagRE   = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacesRE    = regexp.MustCompile(`\s+`)
+)
+
+// errorMessage extracts a human readable message from an error response body
+// JSON bodies provide their message field, HTML pages (e.g. a load balancer 502) their title
+// or text, and plain text bodies are used as is
+func errorMessage(contentType string, body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	if trimmed[0] == '{' || strings.Contains(contentType, "json") {
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		if err := json.Unmarshal(trimmed, &message); err == nil && message.Message != "" {
+			return message.Message
+		}
+	}
+
+	text := string(trimmed)
+	if strings.Contains(contentType, "html") || strings.HasPrefix(text, "<") {
+		if title := htmlTitleRE.FindStringSubmatch(text); title != nil {
+			text = title[1]
+		} else {
+			text = htmlTagRE.ReplaceAllString(text, " ")
+		}
+		text = html.UnescapeString(text)
+	}
+
+	return truncate(strings.TrimSpace(spacesRE.ReplaceAllString(text, " ")), maxErrorMessageLength)
+}
+
+// truncate shortens s to at most max bytes, marking it when it was cut
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "...(truncated)"
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxThrottleWait   = time.Minute // longest time a request waits for the rate limit window to reset
+	lowQuotaDivisor   = 10          // quota is low when less than a tenth of the limit remains
+	epochResetMinimum = 1000000000  // X-RateLimit-Reset values above this are unix timestamps rather than seconds
+)
+
+// rateLimit tracks the quota reported by the X-RateLimit-* response headers
+type rateLimit struct {
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// update records the quota advertised by a response
+// Responses without rate limit headers leave the known quota untouched
+func (r *rateLimit) update(header http.Header, now time.Time) {
+	remaining, err := strconv.Atoi(strings.TrimSpace(header.Get("X-RateLimit-Remaining")))
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.known = true
+	r.remaining = remaining
+	if limit, err := strconv.Atoi(strings.TrimSpace(header.Get("X-RateLimit-Limit"))); err == nil {
+		r.limit = limit
+	}
+	r.reset = parseRateLimitReset(header.Get("X-RateLimit-Reset"), now)
+}
+
+// delay returns how long the next request should wait to stay within the quota
+// Once the quota is exhausted requests wait for the window to reset, when it is
+// merely low they are spread evenly over what is left of the window
+func (r *rateLimit) delay(now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.known || r.reset.IsZero() || !now.Before(r.reset) {
+		return 0
+	}
+
+	untilReset := r.reset.Sub(now)
+
+	var wait time.Duration
+	switch {
+	case r.remaining <= 0:
+		wait = untilReset
+	case r.limit > 0 && r.remaining < r.limit/lowQuotaDivisor:
+		wait = untilReset / time.Duration(r.remaining+1)
+		r.remaining--
+	default:
+		r.remaining--
+		return 0
+	}
+
+	if wait > maxThrottleWait {
+		wait = maxThrottleWait
+	}
+	return wait
+}
+
+func parseRateLimitReset(value string, now time.Time) time.Time {
+	reset, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || reset < 0 {
+		return time.Time{}
+	}
+
+	if reset > epochResetMinimum {
+		return time.Unix(reset, 0)
+	}
+	return now.Add(time.Duration(reset) * time.Second)
+}
+
+// parseRetryAfter reads the Retry-After header, either a number of seconds or an HTTP date
+// Like our own throttling, the wait is capped by maxThrottleWait so that a large or bogus
+// header cannot stall the requests
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		if seconds > int64(maxThrottleWait/time.Second) {
+			return maxThrottleWait
+		}
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		wait = date.Sub(now)
+	}
+
+	if wait > maxThrottleWait {
+		wait = maxThrottleWait
+	}
+	return wait
+}
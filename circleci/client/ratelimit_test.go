@@ -0,0 +1,94 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"45", 45 * time.Second},
+		{"120", maxThrottleWait},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-30 * time.Second).Format(http.TimeFormat), 0},
+		{"86400", maxThrottleWait},
+		{"9223372036854775807", maxThrottleWait},
+		{now.Add(24 * time.Hour).Format(http.TimeFormat), maxThrottleWait},
+	}
+
+	for _, c := range cases {
+		if got := parseRetryAfter(c.value, now); got != c.expected {
+			t.Errorf("%q: expected %s, got %s", c.value, c.expected, got)
+		}
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	header := func(limit, remaining, reset int64) http.Header {
+		h := http.Header{}
+		h.Set("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+		h.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		return h
+	}
+
+	cases := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{"no headers", http.Header{}, 0},
+		{"plenty of quota", header(100, 50, 30), 0},
+		{"low quota", header(100, 4, 30), 6 * time.Second},
+		{"exhausted quota", header(100, 0, 30), 30 * time.Second},
+		{"exhausted quota with epoch reset", header(100, 0, now.Add(20*time.Second).Unix()), 20 * time.Second},
+		{"long reset is capped", header(100, 0, 3600), maxThrottleWait},
+		{"reset in the past", header(100, 0, now.Add(-time.Second).Unix()), 0},
+	}
+
+	for _, c := range cases {
+		r := &rateLimit{}
+		r.update(c.header, now)
+		if got := r.delay(now); got != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestRetryAfterOnAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"message":"rate limit exceeded"}`))
+	}))
+	defer server.Close()
+
+	baseURL, _ := url.Parse(server.URL + "/api/v1.1/")
+	client := &Client{BaseURL: baseURL, Token: testToken}
+
+	_, err := client.ListProjects()
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.RetryAfter != 7*time.Second {
+		t.Errorf("expected a retry after 7s, got %s", apiErr.RetryAfter)
+	}
+	if !IsRetryable(err) {
+		t.Error("expected a rate limited request to be retryable")
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretFields are the JSON fields, query parameters and headers whose values must never be logged
+var secretFields = map[string]bool{
+	"private_key":          true,
+	"value":                true,
+	"apikey":               true,
+	"circle-token":         true,
+	"secret_access_key_id": true,
+}
+
+func isSecretField(name string) bool {
+	return secretFields[strings.ToLower(name)]
+}
+
+// redactURL returns the string form of u with secret query parameters masked
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	if len(query) == 0 {
+		return u.String()
+	}
+
+	for key := range query {
+		if isSecretField(key) {
+			query[key] = []string{redacted}
+		}
+	}
+
+	masked := *u
+	masked.RawQuery = query.Encode()
+	return masked.String()
+}
+
+// redactHeader returns a copy of header with secret headers masked
+func redactHeader(header http.Header) http.Header {
+	masked := make(http.Header, len(header))
+	for key, values := range header {
+		if isSecretField(key) {
+			masked[key] = []string{redacted}
+			continue
+		}
+		masked[key] = values
+	}
+	return masked
+}
+
+// redactBody masks the values of secret fields found anywhere in a JSON body
+// Bodies which are not JSON are returned untouched
+func redactBody(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return body
+	}
+
+	masked, err := json.Marshal(redactValue(decoded))
+	if err != nil {
+		return body
+	}
+	return masked
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSecretField(key) && field != nil {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
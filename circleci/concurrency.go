@@ -0,0 +1,120 @@
+package circleci
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// semaphore bounds the number of concurrent holders, a nil semaphore is unbounded
+type semaphore chan struct{}
+
+func newSemaphore(size int) semaphore {
+	if size <= 0 {
+		return nil
+	}
+	return make(semaphore, size)
+}
+
+// acquire waits for a free slot unless the context is done first
+func (s semaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// projectLocks serializes the mutations of each project
+// Mutations of different projects proceed in parallel
+type projectLocks struct {
+	mutex sync.Mutex
+	locks map[string]semaphore
+}
+
+func newProjectLocks() *projectLocks {
+	return &projectLocks{locks: map[string]semaphore{}}
+}
+
+// lock waits until no other mutation of the project is in progress unless the
+// context is done first. The returned function releases the lock.
+func (l *projectLocks) lock(ctx context.Context, projectName string) (func(), error) {
+	l.mutex.Lock()
+	lock, ok := l.locks[projectName]
+	if !ok {
+		lock = newSemaphore(1)
+		l.locks[projectName] = lock
+	}
+	l.mutex.Unlock()
+
+	if err := lock.acquire(ctx); err != nil {
+		return nil, err
+	}
+	return lock.release, nil
+}
+
+// forEachProject runs operation for every project, at most parallelism at a time
+// It returns the errors of the failed projects by project name
+func forEachProject(ctx context.Context, projectNames []string, parallelism int, operation func(projectName string) error) map[string]error {
+	var mutex sync.Mutex
+	errs := map[string]error{}
+
+	slots := newSemaphore(parallelism)
+	var wg sync.WaitGroup
+	for _, projectName := range projectNames {
+		if err := slots.acquire(ctx); err != nil {
+			mutex.Lock()
+			errs[projectName] = err
+			mutex.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(projectName string) {
+			defer wg.Done()
+			defer slots.release()
+
+			if err := operation(projectName); err != nil {
+				mutex.Lock()
+				errs[projectName] = err
+				mutex.Unlock()
+			}
+		}(projectName)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// projectErrors combines the errors of forEachProject in a single error, nil when there are none
+func projectErrors(operation string, errs map[string]error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	projectNames := make([]string, 0, len(errs))
+	for projectName := range errs {
+		projectNames = append(projectNames, projectName)
+	}
+	sort.Strings(projectNames)
+
+	messages := make([]string, 0, len(errs))
+	for _, projectName := range projectNames {
+		messages = append(messages, fmt.Sprintf("  %s: %s", projectName, errs[projectName]))
+	}
+
+	return fmt.Errorf("unable to %s in %d project(s):\n%s", operation, len(errs), strings.Join(messages, "\n"))
+}
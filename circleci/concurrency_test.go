@@ -0,0 +1,58 @@
+package circleci
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForEachProject(t *testing.T) {
+	var projectNames []string
+	for i := 0; i < 20; i++ {
+		projectNames = append(projectNames, "project"+strconv.Itoa(i))
+	}
+
+	var mutex sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	errs := forEachProject(context.Background(), projectNames, 4, func(projectName string) error {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+
+		if strings.HasSuffix(projectName, "3") {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if maxInFlight > 4 {
+		t.Errorf("expected at most 4 projects in parallel, got %d", maxInFlight)
+	}
+	if len(errs) != 2 || errs["project3"] == nil || errs["project13"] == nil {
+		t.Errorf("expected project3 and project13 to fail, got %v", errs)
+	}
+
+	err := projectErrors("create environment variable NAME", errs)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if expected := "unable to create environment variable NAME in 2 project(s):\n  project13: failed\n  project3: failed"; err.Error() != expected {
+		t.Errorf("unexpected error %q", err)
+	}
+	if projectErrors("create environment variable NAME", nil) != nil {
+		t.Error("expected no error without failures")
+	}
+}
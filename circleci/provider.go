@@ -1,12 +1,19 @@
 package circleci
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/hashicorp/terraform/terraform"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
 )
 
 func Provider() terraform.ResourceProvider {
-	return &schema.Provider{
+	provider := &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"api_token": {
 				Type:        schema.TypeString,
@@ -26,19 +33,150 @@ func Provider() terraform.ResourceProvider {
 				DefaultFunc: schema.EnvDefaultFunc("CIRCLECI_ORGANIZATION", nil),
 				Description: "The CircleCI organization.",
 			},
+			"url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CIRCLECI_URL", "https://circleci.com"),
+				Description: "The URL of the CircleCI host, set it to target a CircleCI Server installation.",
+			},
+			"api_v1_path": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CIRCLECI_API_V1_PATH", "/api/v1.1/"),
+				Description: "The base path of the v1.1 API on the CircleCI host.",
+			},
+			"token_in_query": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CIRCLECI_TOKEN_IN_QUERY", false),
+				Description: "Send the API token as the circle-token query parameter instead of the Circle-Token header, for older CircleCI Server versions.",
+			},
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("CIRCLECI_MAX_RETRIES", 3),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "The maximum number of times a failed API request is retried.",
+			},
+			"retry_initial_interval": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("CIRCLECI_RETRY_INITIAL_INTERVAL", "500ms"),
+				ValidateFunc: validateDuration,
+				Description:  "The time to wait before retrying a failed API request, it grows exponentially with each retry.",
+			},
+			"retry_max_elapsed_time": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("CIRCLECI_RETRY_MAX_ELAPSED_TIME", "15m"),
+				ValidateFunc: validateDuration,
+				Description:  "The time after which a failed API request is not retried anymore.",
+			},
+			"max_concurrent_requests": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("CIRCLECI_MAX_CONCURRENT_REQUESTS", 0),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "The maximum number of concurrent API requests, 0 means unlimited. Changes to a single project are always applied one at a time.",
+			},
+			"skip_credentials_validation": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CIRCLECI_SKIP_CREDENTIALS_VALIDATION", false),
+				Description: "Skip checking the API token against CircleCI when the provider is configured, e.g. for offline plans.",
+			},
+			"overwrite_existing_environment_variables": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CIRCLECI_OVERWRITE_EXISTING_ENVIRONMENT_VARIABLES", false),
+				Description: "Default of overwrite_existing for the circleci_environment_variable resources.",
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
-			"circleci_environment_variable": resourceCircleCIEnvironmentVariable(),
-			"circleci_project":              resourceCircleCIProject(),
-			"circleci_ssh_key":              resourceCircleCISSHKey(),
+			"circleci_checkout_key":             resourceCircleCICheckoutKey(),
+			"circleci_environment_variable":     resourceCircleCIEnvironmentVariable(),
+			"circleci_environment_variable_set": resourceCircleCIEnvironmentVariableSet(),
+			"circleci_project":                  resourceCircleCIProject(),
+			"circleci_project_environment":      resourceCircleCIProjectEnvironment(),
+			"circleci_ssh_key":                  resourceCircleCISSHKey(),
 		},
-		ConfigureFunc: providerConfigure,
 	}
+
+	provider.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
+		return providerConfigure(d, provider.StopContext())
+	}
+
+	return provider
+}
+
+func providerConfigure(d *schema.ResourceData, stopContext context.Context) (interface{}, error) {
+	retryInitialInterval, err := time.ParseDuration(d.Get("retry_initial_interval").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	retryMaxElapsedTime, err := time.ParseDuration(d.Get("retry_max_elapsed_time").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{
+		Token:        d.Get("api_token").(string),
+		VCSType:      d.Get("vcs_type").(string),
+		Organization: d.Get("organization").(string),
+		URL:          d.Get("url").(string),
+		APIV1Path:    d.Get("api_v1_path").(string),
+		TokenInQuery: d.Get("token_in_query").(bool),
+
+		MaxRetries:           uint64(d.Get("max_retries").(int)),
+		RetryInitialInterval: retryInitialInterval,
+		RetryMaxElapsedTime:  retryMaxElapsedTime,
+
+		StopContext: stopContext,
+
+		MaxConcurrentRequests: d.Get("max_concurrent_requests").(int),
+
+		OverwriteExistingEnvVars: d.Get("overwrite_existing_environment_variables").(bool),
+	}
+
+	providerClient, err := NewConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.Get("skip_credentials_validation").(bool) {
+		if err := providerClient.ValidateCredentials(stopContext); err != nil {
+			return nil, err
+		}
+	}
+
+	return providerClient, nil
 }
 
-func providerConfigure(d *schema.ResourceData) (interface{}, error) {
-	token := d.Get("api_token").(string)
-	vcsType := d.Get("vcs_type").(string)
-	organization := d.Get("organization").(string)
-	return NewConfig(token, vcsType, organization), nil
+func validateEnvVarName(i interface{}, keyName string) (warnings []string, errors []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", keyName)}
+	}
+	if !circleciapi.ValidateEnvVarName(v) {
+		return nil, []error{fmt.Errorf("environment variable name %s is not valid. See https://circleci.com/docs/2.0/env-vars/#injecting-environment-variables-with-the-api", v)}
+	}
+
+	return nil, nil
+}
+
+func validateDuration(i interface{}, keyName string) (warnings []string, errors []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", keyName)}
+	}
+	duration, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s is not a valid duration: %s", keyName, err)}
+	}
+	if duration <= 0 {
+		return nil, []error{fmt.Errorf("%s must be a positive duration, got %s", keyName, v)}
+	}
+
+	return nil, nil
 }
@@ -1,37 +1,305 @@
 package circleci
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
 	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
 	"github.com/cenkalti/backoff"
+	"github.com/hashicorp/terraform/helper/logging"
 )
 
+// Config holds the provider settings used to build a ProviderClient
+type Config struct {
+	Token        string
+	VCSType      string
+	Organization string
+	URL          string // CircleCI host, e.g. https://circleci.com or a CircleCI Server installation
+	APIV1Path    string // base path of the v1.1 API on the host
+	TokenInQuery bool   // authenticate with the circle-token query parameter instead of the Circle-Token header
+
+	MaxRetries           uint64        // number of times a failed request is retried
+	RetryInitialInterval time.Duration // wait before the first retry, it grows exponentially for the next ones
+	RetryMaxElapsedTime  time.Duration // give up retrying once this much time has passed since the first attempt
+
+	StopContext context.Context // cancelled when Terraform stops the provider, e.g. on Ctrl-C
+
+	MaxConcurrentRequests int // maximum number of API requests in flight, unlimited when zero
+
+	OverwriteExistingEnvVars bool // default of overwrite_existing for environment variables
+}
+
 // ProviderClient is a thin commodity wrapper on top of circleciapi
 type ProviderClient struct {
 	client       *circleciapi.Client
 	vcsType      string
 	organization string
+
+	maxRetries           uint64
+	retryInitialInterval time.Duration
+	retryMaxElapsedTime  time.Duration
+
+	stopContext context.Context
+
+	userMutex sync.Mutex
+	user      *circleciapi.User // user owning the API token, once it has been validated
+
+	cache *readCache
+
+	requests     semaphore     // bounds the API requests in flight
+	projectLocks *projectLocks // serializes the mutations of each project
+
+	overwriteExistingEnvVars bool
 }
 
 // NewConfig initialize circleci API client and returns a new config object
-func NewConfig(token, vscType, organization string) *ProviderClient {
-	return &ProviderClient{
-		client: &circleciapi.Client{
-			Token: token,
-		},
-		vcsType:      vscType,
-		organization: organization,
+func NewConfig(config *Config) (*ProviderClient, error) {
+	client := &circleciapi.Client{
+		Token:      config.Token,
+		TokenQuery: config.TokenInQuery,
+		Debug:      logging.IsDebugOrHigher(),
+		Logger:     terraformLogger{},
+	}
+
+	if config.URL != "" {
+		baseURL, err := apiURL(config.URL, config.APIV1Path)
+		if err != nil {
+			return nil, err
+		}
+		client.BaseURL = baseURL
+	}
+
+	pv := &ProviderClient{
+		client:               client,
+		vcsType:              config.VCSType,
+		organization:         config.Organization,
+		maxRetries:           config.MaxRetries,
+		retryInitialInterval: config.RetryInitialInterval,
+		retryMaxElapsedTime:  config.RetryMaxElapsedTime,
+		stopContext:          config.StopContext,
+		cache:                newReadCache(),
+		requests:             newSemaphore(config.MaxConcurrentRequests),
+		projectLocks:         newProjectLocks(),
+
+		overwriteExistingEnvVars: config.OverwriteExistingEnvVars,
+	}
+	if pv.stopContext == nil {
+		pv.stopContext = context.Background()
 	}
+	if pv.retryInitialInterval <= 0 {
+		pv.retryInitialInterval = backoff.DefaultInitialInterval
+	}
+	if pv.retryMaxElapsedTime <= 0 {
+		pv.retryMaxElapsedTime = backoff.DefaultMaxElapsedTime
+	}
+
+	return pv, nil
+}
+
+// withTimeout returns a context bounded by a resource timeout
+// It is also cancelled when Terraform stops the provider
+func (pv *ProviderClient) withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(pv.stopContext, timeout)
+}
+
+// terraformLogger sends the API client debug messages to the Terraform log
+// They are only displayed when TF_LOG is set to DEBUG or TRACE
+type terraformLogger struct{}
+
+func (terraformLogger) Printf(format string, args ...interface{}) {
+	log.Printf("[DEBUG] circleci: "+format, args...)
+}
+
+// apiURL joins the CircleCI host with an API base path
+// The returned path always ends with a slash so relative endpoints resolve beneath it
+func apiURL(host, path string) (*url.URL, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CircleCI URL %q: %s", host, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid CircleCI URL %q: scheme and host are required", host)
+	}
+
+	segments := []string{}
+	for _, segment := range []string{u.Path, path} {
+		if segment = strings.Trim(segment, "/"); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	u.Path = "/" + strings.Join(segments, "/")
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return u, nil
+}
+
+// serverBackOff waits for the delay requested by the server through Retry-After when
+// there is one, falling back to the wrapped policy otherwise
+type serverBackOff struct {
+	backoff.BackOff
+	retryAfter time.Duration
+}
+
+func (b *serverBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop || b.retryAfter <= 0 {
+		return next
+	}
+	return b.retryAfter
+}
+
+// retry runs the operation with the provider retry policy until it succeeds or the context is done
+// Errors which cannot succeed on a new attempt are returned immediately
+func (pv *ProviderClient) retry(ctx context.Context, operation func() error) error {
+	exponential := backoff.NewExponentialBackOff()
+	exponential.InitialInterval = pv.retryInitialInterval
+	exponential.MaxElapsedTime = pv.retryMaxElapsedTime
+
+	policy := &serverBackOff{BackOff: backoff.WithMaxRetries(exponential, pv.maxRetries)}
+
+	return backoff.Retry(func() error {
+		if err := pv.requests.acquire(ctx); err != nil {
+			return backoff.Permanent(err)
+		}
+		err := operation()
+		pv.requests.release()
+
+		policy.retryAfter = 0
+		var apiErr *circleciapi.APIError
+		if errors.As(err, &apiErr) {
+			policy.retryAfter = apiErr.RetryAfter
+		}
+
+		if err != nil && !circleciapi.IsRetryable(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(policy, ctx))
+}
+
+// mutate runs a write operation on the project with the provider retry policy
+// It waits for the previous mutations of the same project to be done, so they are applied in order
+func (pv *ProviderClient) mutate(ctx context.Context, projectName string, operation func() error) error {
+	unlock, err := pv.projectLocks.lock(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return pv.retry(ctx, operation)
+}
+
+// Me returns the user owning the API token
+// Only personal API tokens are tied to a user, project tokens are rejected by CircleCI
+func (pv *ProviderClient) Me(ctx context.Context) (*circleciapi.User, error) {
+	pv.userMutex.Lock()
+	defer pv.userMutex.Unlock()
+
+	if pv.user != nil {
+		return pv.user, nil
+	}
+
+	var err error
+	var user *circleciapi.User
+	err = pv.retry(ctx, func() error {
+		user, err = pv.client.MeWithContext(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pv.user = user
+	return user, nil
+}
+
+// ValidateCredentials checks the API token is accepted by CircleCI
+// Project tokens are rejected by the user endpoint the check relies on, so a rejected token is
+// accepted as a possible project token. The operations requiring a personal API token check it
+// with RequirePersonalToken
+func (pv *ProviderClient) ValidateCredentials(ctx context.Context) error {
+	user, err := pv.Me(ctx)
+	if errors.Is(err, circleciapi.ErrUnauthorized) || errors.Is(err, circleciapi.ErrForbidden) {
+		log.Printf("[INFO] circleci: the API token for organization %q is not a personal API token (%s), assuming it is a project token", pv.organization, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to validate the CircleCI API token for organization %q: %s. Set skip_credentials_validation to skip this check", pv.organization, err)
+	}
+
+	log.Printf("[INFO] circleci: authenticated as %q for organization %q", user.Login, pv.organization)
+	return nil
+}
+
+// RequirePersonalToken checks the API token is a personal API token
+// Some operations, e.g. creating github-user-key checkout keys, act on behalf of a user
+// and cannot be performed with a project token
+func (pv *ProviderClient) RequirePersonalToken(ctx context.Context, operation string) error {
+	user, err := pv.Me(ctx)
+	if err != nil {
+		return fmt.Errorf("%s requires a personal API token for organization %q: %s", operation, pv.organization, err)
+	}
+	if user.Login == "" {
+		return fmt.Errorf("%s requires a personal API token for organization %q, the configured token is not tied to a user", operation, pv.organization)
+	}
+
+	return nil
+}
+
+// ListEnvVars lists the environment variables of the project, indexed by name (values are masked)
+// The list is read once and cached until an environment variable of the project is modified.
+// A project which does not exist has no environment variables
+func (pv *ProviderClient) ListEnvVars(ctx context.Context, projectName string) (map[string]circleciapi.EnvVar, error) {
+	value, err := pv.cache.get(ctx, envVarsCacheKey(projectName), func() (interface{}, error) {
+		var err error
+		var envVars []circleciapi.EnvVar
+		err = pv.retry(ctx, func() error {
+			envVars, err = pv.client.ListEnvVarsWithContext(ctx, pv.vcsType, pv.organization, projectName)
+			return err
+		})
+		if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
+			return nil, err
+		}
+
+		byName := make(map[string]circleciapi.EnvVar, len(envVars))
+		for _, envVar := range envVars {
+			byName[envVar.Name] = envVar
+		}
+		return byName, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(map[string]circleciapi.EnvVar), nil
 }
 
 // GetEnvVar get the environment variable with given name
 // It returns an empty structure if no environment variable exists with that name
-func (pv *ProviderClient) GetEnvVar(projectName, envVarName string) (*circleciapi.EnvVar, error) {
-	return pv.client.GetEnvVar(pv.vcsType, pv.organization, projectName, envVarName)
+func (pv *ProviderClient) GetEnvVar(ctx context.Context, projectName, envVarName string) (*circleciapi.EnvVar, error) {
+	envVars, err := pv.ListEnvVars(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	envVar := envVars[envVarName]
+	return &envVar, nil
 }
 
 // EnvVarExists check if environment variable exists with given name
-func (pv *ProviderClient) EnvVarExists(projectName, envVarName string) (bool, error) {
-	envVar, err := pv.client.GetEnvVar(pv.vcsType, pv.organization, projectName, envVarName)
+func (pv *ProviderClient) EnvVarExists(ctx context.Context, projectName, envVarName string) (bool, error) {
+	envVar, err := pv.GetEnvVar(ctx, projectName, envVarName)
 	if err != nil {
 		return false, err
 	}
@@ -39,77 +307,267 @@ func (pv *ProviderClient) EnvVarExists(projectName, envVarName string) (bool, er
 }
 
 // AddEnvVar create an environment variable with given name and value
-func (pv *ProviderClient) AddEnvVar(projectName, envVarName, envVarValue string) (*circleciapi.EnvVar, error) {
-	return pv.client.AddEnvVar(pv.vcsType, pv.organization, projectName, envVarName, envVarValue)
+func (pv *ProviderClient) AddEnvVar(ctx context.Context, projectName, envVarName, envVarValue string) (*circleciapi.EnvVar, error) {
+	defer pv.cache.invalidate(envVarsCacheKey(projectName))
+
+	var err error
+	var envVar *circleciapi.EnvVar
+	err = pv.mutate(ctx, projectName, func() error {
+		envVar, err = pv.client.AddEnvVarWithContext(ctx, pv.vcsType, pv.organization, projectName, envVarName, envVarValue)
+		return err
+	})
+	return envVar, err
 }
 
 // DeleteEnvVar delete the environment variable with given name
-func (pv *ProviderClient) DeleteEnvVar(projectName, envVarName string) error {
-	retry := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+func (pv *ProviderClient) DeleteEnvVar(ctx context.Context, projectName, envVarName string) error {
+	defer pv.cache.invalidate(envVarsCacheKey(projectName))
 
-	return backoff.Retry(func() error {
-		return pv.client.DeleteEnvVar(pv.vcsType, pv.organization, projectName, envVarName)
-	}, retry)
+	return pv.mutate(ctx, projectName, func() error {
+		return pv.client.DeleteEnvVarWithContext(ctx, pv.vcsType, pv.organization, projectName, envVarName)
+	})
 }
 
 // GetProject reads the project with given name
-func (pv *ProviderClient) GetProject(projectName string) (*circleciapi.Project, error) {
-	retry := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+// Watched projects are served from a single cached list of projects, other projects
+// are looked up (and cached) one by one. It returns nil if the project does not exist
+func (pv *ProviderClient) GetProject(ctx context.Context, projectName string) (*circleciapi.Project, error) {
+	projects, err := pv.listWatchedProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	var err error
-	var project *circleciapi.Project
-	err = backoff.Retry(func() error {
-		project, err = pv.client.GetProject(pv.organization, projectName)
-		return err
-	}, retry)
-	return project, err
+	if project := pv.findProject(projects, projectName); project != nil {
+		return project, nil
+	}
+
+	return pv.getProjectSettings(ctx, projectName)
+}
+
+// GetFollowedProject reads the project with given name if it is followed, and returns nil otherwise
+// Unlike GetProject, which also finds projects which are not followed, it tells whether a project
+// is still built by CircleCI. The list of watched projects is authoritative, the settings of the
+// project are only used when the token cannot list projects
+func (pv *ProviderClient) GetFollowedProject(ctx context.Context, projectName string) (*circleciapi.Project, error) {
+	projects, err := pv.listWatchedProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if projects != nil {
+		return pv.findProject(projects, projectName), nil
+	}
+
+	project, err := pv.getProjectSettings(ctx, projectName)
+	if err != nil || project == nil || !project.Followed {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+// listWatchedProjects returns the cached list of projects followed by the token owner
+// It returns nil when the token cannot list projects, e.g. project tokens
+func (pv *ProviderClient) listWatchedProjects(ctx context.Context) ([]*circleciapi.Project, error) {
+	projects, err := pv.cache.get(ctx, projectsCacheKey, func() (interface{}, error) {
+		var err error
+		var projects []*circleciapi.Project
+		err = pv.retry(ctx, func() error {
+			projects, err = pv.client.ListProjectsWithContext(ctx)
+			return err
+		})
+		if err != nil && ctx.Err() == nil && !circleciapi.IsRetryable(err) {
+			log.Printf("[WARN] circleci: unable to list projects, looking them up individually: %s", err)
+			return []*circleciapi.Project(nil), nil
+		}
+		if projects == nil {
+			projects = []*circleciapi.Project{}
+		}
+		return projects, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return projects.([]*circleciapi.Project), nil
+}
+
+// findProject returns the project with given name of the provider organization and VCS type, or nil
+func (pv *ProviderClient) findProject(projects []*circleciapi.Project, projectName string) *circleciapi.Project {
+	for _, project := range projects {
+		if project.Username == pv.organization && project.Reponame == projectName && project.IsVCSType(pv.vcsType) {
+			return project
+		}
+	}
+	return nil
+}
+
+// getProjectSettings reads the settings of the project with given name, cached until the project is modified
+// It returns nil if the project does not exist
+// When the settings are unavailable, e.g. on CircleCI Server installations without the settings endpoint,
+// the project is looked up in the cached list of watched projects
+func (pv *ProviderClient) getProjectSettings(ctx context.Context, projectName string) (*circleciapi.Project, error) {
+	project, err := pv.cache.get(ctx, projectCacheKey(projectName), func() (interface{}, error) {
+		var err error
+		var project *circleciapi.Project
+		err = pv.retry(ctx, func() error {
+			project, err = pv.client.GetProjectSettingsWithContext(ctx, pv.vcsType, pv.organization, projectName)
+			return err
+		})
+		if !circleciapi.ProjectSettingsUnavailable(err) {
+			return project, err
+		}
+
+		projects, listErr := pv.listWatchedProjects(ctx)
+		switch {
+		case listErr != nil:
+			return (*circleciapi.Project)(nil), listErr
+		case projects != nil:
+			return pv.findProject(projects, projectName), nil
+		case errors.Is(err, circleciapi.ErrNotFound):
+			// the token cannot list projects, the settings endpoint is the only one to tell
+			return (*circleciapi.Project)(nil), nil
+		default:
+			return (*circleciapi.Project)(nil), err
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return project.(*circleciapi.Project), nil
+}
+
+// invalidateProject drops the cached reads of the project
+func (pv *ProviderClient) invalidateProject(projectName string) {
+	pv.cache.invalidate(projectsCacheKey, projectCacheKey(projectName))
 }
 
 // EnableProject enables the project with given name
-func (pv *ProviderClient) EnableProject(projectName string) error {
-	retry := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+func (pv *ProviderClient) EnableProject(ctx context.Context, projectName string) error {
+	defer pv.invalidateProject(projectName)
 
-	return backoff.Retry(func() error {
-		return pv.client.EnableProject(pv.vcsType, pv.organization, projectName)
-	}, retry)
+	return pv.mutate(ctx, projectName, func() error {
+		return pv.client.EnableProjectWithContext(ctx, pv.vcsType, pv.organization, projectName)
+	})
 }
 
 // FollowProject follows the project with given name
-func (pv *ProviderClient) FollowProject(projectName string) (*circleciapi.Project, error) {
-	retry := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+func (pv *ProviderClient) FollowProject(ctx context.Context, projectName string) (*circleciapi.Project, error) {
+	defer pv.invalidateProject(projectName)
 
 	var err error
 	var project *circleciapi.Project
-	err = backoff.Retry(func() error {
-		project, err = pv.client.FollowProject(pv.vcsType, pv.organization, projectName)
+	err = pv.mutate(ctx, projectName, func() error {
+		project, err = pv.client.FollowProjectWithContext(ctx, pv.vcsType, pv.organization, projectName)
 		return err
-	}, retry)
+	})
 	return project, err
 }
 
 // DisableProject disables the project with given name
-func (pv *ProviderClient) DisableProject(projectName string) error {
-	retry := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+func (pv *ProviderClient) DisableProject(ctx context.Context, projectName string) error {
+	defer pv.invalidateProject(projectName)
 
-	return backoff.Retry(func() error {
-		return pv.client.DisableProject(pv.vcsType, pv.organization, projectName)
-	}, retry)
+	return pv.mutate(ctx, projectName, func() error {
+		return pv.client.DisableProjectWithContext(ctx, pv.vcsType, pv.organization, projectName)
+	})
 }
 
 // AddSSHKey adds an ssh private key to the project
-func (pv *ProviderClient) AddSSHKey(projectName, hostname, privateKey string) error {
-	retry := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+func (pv *ProviderClient) AddSSHKey(ctx context.Context, projectName, hostname, privateKey string) error {
+	defer pv.invalidateProject(projectName)
 
-	return backoff.Retry(func() error {
-		return pv.client.AddSSHKey(pv.vcsType, pv.organization, projectName, hostname, privateKey)
-	}, retry)
+	return pv.mutate(ctx, projectName, func() error {
+		return pv.client.AddSSHKeyWithContext(ctx, pv.vcsType, pv.organization, projectName, hostname, privateKey)
+	})
+}
+
+// ListSSHKeys lists the ssh keys of the project, a project which does not exist has none
+// They are read from the project settings, the list of projects does not include them
+func (pv *ProviderClient) ListSSHKeys(ctx context.Context, projectName string) ([]*circleciapi.PublicSSHKey, error) {
+	project, err := pv.getProjectSettings(ctx, projectName)
+	if err != nil || project == nil {
+		return nil, err
+	}
+
+	return project.SSHKeys, nil
 }
 
 // DeleteSSHKey deletes an ssh private key from the project
-func (pv *ProviderClient) DeleteSSHKey(projectName, hostname, fingerprint string) error {
-	retry := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
+func (pv *ProviderClient) DeleteSSHKey(ctx context.Context, projectName, hostname, fingerprint string) error {
+	defer pv.invalidateProject(projectName)
 
-	return backoff.Retry(func() error {
-		return pv.client.DeleteSSHKey(pv.vcsType, pv.organization, projectName, hostname, fingerprint)
-	}, retry)
+	return pv.mutate(ctx, projectName, func() error {
+		return pv.client.DeleteSSHKeyWithContext(ctx, pv.vcsType, pv.organization, projectName, hostname, fingerprint)
+	})
+}
+
+// CreateCheckoutKey creates a checkout key of the given type, deploy-key or github-user-key, for the project
+// Creating a key is not idempotent, a failed request may still have created it: before sending the request
+// again, the keys of the project are listed and a new key of the same type is taken as the one created
+func (pv *ProviderClient) CreateCheckoutKey(ctx context.Context, projectName, keyType string) (*circleciapi.CheckoutKey, error) {
+	unlock, err := pv.projectLocks.lock(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var existing []*circleciapi.CheckoutKey
+	err = pv.retry(ctx, func() error {
+		var err error
+		existing, err = pv.client.ListCheckoutKeysWithContext(ctx, pv.vcsType, pv.organization, projectName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, checkoutKey := range existing {
+		known[checkoutKey.Fingerprint] = true
+	}
+
+	var checkoutKey *circleciapi.CheckoutKey
+	sent := false
+	err = pv.retry(ctx, func() error {
+		if sent {
+			checkoutKeys, err := pv.client.ListCheckoutKeysWithContext(ctx, pv.vcsType, pv.organization, projectName)
+			if err != nil {
+				return err
+			}
+			for _, key := range checkoutKeys {
+				if key.Type == keyType && !known[key.Fingerprint] {
+					checkoutKey = key
+					return nil
+				}
+			}
+		}
+
+		sent = true
+		var err error
+		checkoutKey, err = pv.client.CreateCheckoutKeyWithContext(ctx, pv.vcsType, pv.organization, projectName, keyType)
+		return err
+	})
+	return checkoutKey, err
+}
+
+// GetCheckoutKey gets the checkout key of the project with given fingerprint
+// It returns nil if the key does not exist
+func (pv *ProviderClient) GetCheckoutKey(ctx context.Context, projectName, fingerprint string) (*circleciapi.CheckoutKey, error) {
+	var checkoutKey *circleciapi.CheckoutKey
+	err := pv.retry(ctx, func() error {
+		var err error
+		checkoutKey, err = pv.client.GetCheckoutKeyWithContext(ctx, pv.vcsType, pv.organization, projectName, fingerprint)
+		return err
+	})
+	if errors.Is(err, circleciapi.ErrNotFound) {
+		return nil, nil
+	}
+	return checkoutKey, err
+}
+
+// DeleteCheckoutKey deletes the checkout key of the project with given fingerprint
+func (pv *ProviderClient) DeleteCheckoutKey(ctx context.Context, projectName, fingerprint string) error {
+	return pv.mutate(ctx, projectName, func() error {
+		return pv.client.DeleteCheckoutKeyWithContext(ctx, pv.vcsType, pv.organization, projectName, fingerprint)
+	})
 }
@@ -0,0 +1,371 @@
+package circleci
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
+)
+
+// testProviderClientFor returns a ProviderClient of the github organization org, talking to a server answering
+// with handler. Failed requests are retried twice, without waiting
+// The server is closed with the test
+func testProviderClientFor(t *testing.T, handler http.HandlerFunc) *ProviderClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	pv, err := NewConfig(&Config{
+		Token:                "token",
+		VCSType:              "github",
+		Organization:         "org",
+		URL:                  server.URL,
+		APIV1Path:            "/api/v1.1/",
+		MaxRetries:           2,
+		RetryInitialInterval: time.Millisecond,
+		RetryMaxElapsedTime:  time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pv
+}
+
+// testStatusHandler answers every request with status, counting them in requests
+func testStatusHandler(status int, requests *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"message":"test"}`))
+	}
+}
+
+func TestProviderClientRetry(t *testing.T) {
+	cases := []struct {
+		status   int
+		requests int32
+	}{
+		{http.StatusBadRequest, 1},
+		{http.StatusUnauthorized, 1},
+		{http.StatusForbidden, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusInternalServerError, 3},
+		{http.StatusBadGateway, 3},
+	}
+
+	for _, c := range cases {
+		var requests int32
+		pv := testProviderClientFor(t, testStatusHandler(c.status, &requests))
+
+		if _, err := pv.AddEnvVar(context.Background(), "project", "NAME", "value"); err == nil {
+			t.Errorf("%d: expected an error", c.status)
+		}
+
+		if requests := atomic.LoadInt32(&requests); requests != c.requests {
+			t.Errorf("%d: expected %d requests, got %d", c.status, c.requests, requests)
+		}
+	}
+}
+
+func TestAPIURL(t *testing.T) {
+	cases := []struct {
+		host, path, expected string
+	}{
+		{"https://circleci.com", "/api/v1.1/", "https://circleci.com/api/v1.1/"},
+		{"https://circleci.com/", "api/v1.1", "https://circleci.com/api/v1.1/"},
+		{"http://circleci.internal:8080/circle", "/api/v1.1", "http://circleci.internal:8080/circle/api/v1.1/"},
+		{"https://circleci.internal", "", "https://circleci.internal/"},
+	}
+
+	for _, c := range cases {
+		u, err := apiURL(c.host, c.path)
+		if err != nil {
+			t.Errorf("%s %s: %s", c.host, c.path, err)
+			continue
+		}
+		if u.String() != c.expected {
+			t.Errorf("%s %s: expected %s, got %s", c.host, c.path, c.expected, u)
+		}
+	}
+
+	if _, err := apiURL("circleci.com", "/api/v1.1/"); err == nil {
+		t.Error("expected an error for a URL without scheme")
+	}
+}
+
+func TestProviderClientRetryStopsWithContext(t *testing.T) {
+	var requests int32
+	pv := testProviderClientFor(t, testStatusHandler(http.StatusServiceUnavailable, &requests))
+
+	pv.maxRetries = 100
+	pv.retryInitialInterval = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := pv.DeleteEnvVar(ctx, "project", "NAME"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("retries were not bounded by the context, took %s", elapsed)
+	}
+}
+
+func TestValidateCredentials(t *testing.T) {
+	cases := []struct {
+		status   int
+		requests int32
+		valid    bool
+	}{
+		{http.StatusOK, 1, true},
+		// project tokens are rejected by the user endpoint
+		{http.StatusUnauthorized, 1, true},
+		{http.StatusForbidden, 1, true},
+		{http.StatusNotFound, 1, false},
+		{http.StatusServiceUnavailable, 3, false},
+	}
+
+	for _, c := range cases {
+		var requests int32
+		pv := testProviderClientFor(t, testStatusHandler(c.status, &requests))
+
+		err := pv.ValidateCredentials(context.Background())
+		if c.valid && err != nil {
+			t.Errorf("%d: expected the token to be accepted, got %s", c.status, err)
+		}
+		if !c.valid && (err == nil || !strings.Contains(err.Error(), `organization "org"`)) {
+			t.Errorf("%d: expected an error naming the organization, got %v", c.status, err)
+		}
+		if requests := atomic.LoadInt32(&requests); requests != c.requests {
+			t.Errorf("%d: expected %d requests, got %d", c.status, c.requests, requests)
+		}
+	}
+
+	var requests int32
+	pv := testProviderClientFor(t, testStatusHandler(http.StatusUnauthorized, &requests))
+	if err := pv.RequirePersonalToken(context.Background(), "test"); err == nil || !strings.Contains(err.Error(), "personal API token") {
+		t.Errorf("expected a rejected token not to be accepted as a personal API token, got %v", err)
+	}
+}
+
+func TestProviderClientReadCache(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	pv := testProviderClientFor(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v1.1/projects":
+			w.Write([]byte(`[{"username":"org","reponame":"followed","vcs_url":"https://github.com/org/followed"}]`))
+		case "/api/v1.1/project/github/org/other/settings":
+			w.Write([]byte(`{}`))
+		case "/api/v1.1/project/github/org/followed/envvar":
+			if r.Method == "POST" {
+				w.Write([]byte(`{"name":"THREE","value":"xxxxalue"}`))
+				return
+			}
+			w.Write([]byte(`[{"name":"ONE","value":"xxxx1111"},{"name":"TWO","value":"xxxx2222"}]`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	})
+
+	count := func(request string) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests[request]
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, name := range []string{"ONE", "TWO", "MISSING"} {
+				if _, err := pv.GetEnvVar(ctx, "followed", name); err != nil {
+					t.Error(err)
+				}
+			}
+			for _, name := range []string{"followed", "other"} {
+				if project, err := pv.GetProject(ctx, name); err != nil || project == nil {
+					t.Errorf("unable to get project %s: %v", name, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	envVar, err := pv.GetEnvVar(ctx, "followed", "TWO")
+	if err != nil || envVar.Value != "xxxx2222" {
+		t.Errorf("unexpected environment variable %+v: %v", envVar, err)
+	}
+
+	expectedRequests := map[string]int{
+		"GET /api/v1.1/projects":                           1,
+		"GET /api/v1.1/project/github/org/other/settings":  1,
+		"GET /api/v1.1/project/github/org/followed/envvar": 1,
+	}
+	for request, expected := range expectedRequests {
+		if got := count(request); got != expected {
+			t.Errorf("expected %d %s requests, got %d", expected, request, got)
+		}
+	}
+
+	if _, err := pv.AddEnvVar(ctx, "followed", "THREE", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pv.GetEnvVar(ctx, "followed", "THREE"); err != nil {
+		t.Fatal(err)
+	}
+	if got := count("GET /api/v1.1/project/github/org/followed/envvar"); got != 2 {
+		t.Errorf("expected writes to invalidate the environment variables cache, got %d list requests", got)
+	}
+}
+
+func TestGetProjectSettingsFallback(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	pv := testProviderClientFor(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v1.1/projects":
+			w.Write([]byte(`[{"username":"org","reponame":"server","vcs_url":"https://github.com/org/server"}]`))
+		case "/api/v1.1/project/github/org/server/settings":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte(`{"message":"Method not allowed"}`))
+		case "/api/v1.1/project/github/org/forbidden/settings":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Permission denied"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Project not found"}`))
+		}
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if keys, err := pv.ListSSHKeys(ctx, "missing"); err != nil || keys != nil {
+			t.Errorf("expected a missing project to have no keys, got %v, %v", keys, err)
+		}
+	}
+	if project, err := pv.getProjectSettings(ctx, "server"); err != nil || project == nil {
+		t.Errorf("expected the project to be found in the list of projects, got %v", err)
+	}
+	if _, err := pv.ListSSHKeys(ctx, "forbidden"); !errors.Is(err, circleciapi.ErrForbidden) {
+		t.Errorf("expected a permission problem not to be taken for a missing project, got %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	expectedRequests := map[string]int{
+		"/api/v1.1/projects":                              1,
+		"/api/v1.1/project/github/org/missing/settings":   1,
+		"/api/v1.1/project/github/org/server/settings":    1,
+		"/api/v1.1/project/github/org/forbidden/settings": 1,
+	}
+	for path, expected := range expectedRequests {
+		if requests[path] != expected {
+			t.Errorf("expected %d %s requests, got %d", expected, path, requests[path])
+		}
+	}
+}
+
+func TestProviderClientConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	inFlight, maxInFlight := map[string]int{}, map[string]int{}
+	track := func(key string, delta int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		inFlight[key] += delta
+		if inFlight[key] > maxInFlight[key] {
+			maxInFlight[key] = inFlight[key]
+		}
+	}
+
+	pv := testProviderClientFor(t, func(w http.ResponseWriter, r *http.Request) {
+		track("all", 1)
+		track(r.URL.Path, 1)
+		time.Sleep(10 * time.Millisecond)
+		track(r.URL.Path, -1)
+		track("all", -1)
+		w.Write([]byte(`{}`))
+	})
+	pv.requests = newSemaphore(3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			project := "project" + strconv.Itoa(i%4)
+			if _, err := pv.AddEnvVar(context.Background(), project, "NAME"+strconv.Itoa(i), "value"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if maxInFlight["all"] > 3 {
+		t.Errorf("expected at most 3 requests in flight, got %d", maxInFlight["all"])
+	}
+	if maxInFlight["all"] < 2 {
+		t.Errorf("expected different projects to be modified in parallel, got %d requests in flight", maxInFlight["all"])
+	}
+	for path, max := range maxInFlight {
+		if path != "all" && max > 1 {
+			t.Errorf("expected mutations of %s to be serialized, got %d in flight", path, max)
+		}
+	}
+}
+
+func TestGetFollowedProject(t *testing.T) {
+	for _, listStatus := range []int{http.StatusOK, http.StatusForbidden} {
+		pv := testProviderClientFor(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v1.1/projects":
+				w.WriteHeader(listStatus)
+				w.Write([]byte(`[{"username":"org","reponame":"followed","vcs_url":"https://github.com/org/followed"}]`))
+			case "/api/v1.1/project/github/org/followed/settings":
+				w.Write([]byte(`{"followed":true}`))
+			case "/api/v1.1/project/github/org/unfollowed/settings":
+				w.Write([]byte(`{"followed":false}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message":"Project not found"}`))
+			}
+		})
+		ctx := context.Background()
+
+		if project, err := pv.GetFollowedProject(ctx, "followed"); err != nil || project == nil {
+			t.Errorf("list %d: expected the followed project, got %v", listStatus, err)
+		}
+		if project, err := pv.GetFollowedProject(ctx, "unfollowed"); err != nil || project != nil {
+			t.Errorf("list %d: expected no project once it is not followed anymore, got %+v, %v", listStatus, project, err)
+		}
+		if project, err := pv.GetProject(ctx, "unfollowed"); err != nil || project == nil {
+			t.Errorf("list %d: expected GetProject to find projects which are not followed, got %v", listStatus, err)
+		}
+		if project, err := pv.GetFollowedProject(ctx, "missing"); err != nil || project != nil {
+			t.Errorf("list %d: expected no project, got %+v, %v", listStatus, project, err)
+		}
+	}
+}
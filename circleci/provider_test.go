@@ -1,6 +1,7 @@
 package circleci
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -119,7 +120,7 @@ func testCircleCICheckDestroy(s *terraform.State) error {
 			continue
 		}
 
-		project, err := providerClient.GetProject(rs.Primary.Attributes["project"])
+		project, err := providerClient.GetFollowedProject(context.Background(), rs.Primary.Attributes["project"])
 		if err != nil {
 			return err
 		}
@@ -127,7 +128,7 @@ func testCircleCICheckDestroy(s *terraform.State) error {
 			return fmt.Errorf("Project should have been destroyed")
 		}
 
-		envVar, err := providerClient.GetEnvVar(rs.Primary.Attributes["project"], rs.Primary.Attributes["name"])
+		envVar, err := providerClient.GetEnvVar(context.Background(), rs.Primary.Attributes["project"], rs.Primary.Attributes["name"])
 		if err != nil {
 			return err
 		}
@@ -159,6 +160,7 @@ func TestCircleCICreateThenUpdate(t *testing.T) {
 					resource.TestCheckResourceAttr(resourceName, "project", project),
 					resource.TestCheckResourceAttr(resourceName, "name", envName),
 					resource.TestCheckResourceAttr(resourceName, "value", "value-for-the-test"),
+					resource.TestCheckResourceAttr(resourceName, "masked_value", "xxxxtest"),
 				),
 			},
 			{
@@ -167,6 +169,7 @@ func TestCircleCICreateThenUpdate(t *testing.T) {
 					resource.TestCheckResourceAttr(resourceName, "project", project),
 					resource.TestCheckResourceAttr(resourceName, "name", envName),
 					resource.TestCheckResourceAttr(resourceName, "value", "value-for-the-test-again"),
+					resource.TestCheckResourceAttr(resourceName, "masked_value", "xxxxgain"),
 				),
 			},
 		},
@@ -202,3 +205,67 @@ func TestCircleCICreateAlreadyExists(t *testing.T) {
 		},
 	})
 }
+
+func testCircleCIEnvironmentVariableSecretConfig(project, name, value string) string {
+	return fmt.Sprintf(`
+resource "circleci_project" "%[1]s" {
+  repo = "%[1]s"
+}
+
+resource "circleci_environment_variable" "%[2]s" {
+  project      = "${circleci_project.%[1]s.id}"
+  name         = "%[2]s"
+  secret_value = "%[3]s"
+}`, project, name, value)
+}
+
+// testCheckSecretValueHash checks that the state holds the hash of value, salted with the salt of the resource
+func testCheckSecretValueHash(resourceName, value string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("resource %s not found", resourceName)
+		}
+
+		salt := rs.Primary.Attributes["secret_value_salt"]
+		if salt == "" {
+			return fmt.Errorf("resource %s has no secret_value_salt", resourceName)
+		}
+		if hash := hashSecret(salt, value); rs.Primary.Attributes["secret_value"] != hash {
+			return fmt.Errorf("expected secret_value to be %q, got %q", hash, rs.Primary.Attributes["secret_value"])
+		}
+
+		return nil
+	}
+}
+
+func TestCircleCISecretValue(t *testing.T) {
+	project := os.Getenv("CIRCLECI_PROJECT")
+	envName := "TEST_" + acctest.RandString(8)
+
+	resourceName := "circleci_environment_variable." + envName
+
+	resource.Test(t, resource.TestCase{
+		PreCheck: func() {
+			testPreCheck(t)
+		},
+		Providers:    testProviders,
+		CheckDestroy: testCircleCICheckDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCircleCIEnvironmentVariableSecretConfig(project, envName, "secret-for-the-test"),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSecretValueHash(resourceName, "secret-for-the-test"),
+					resource.TestCheckResourceAttr(resourceName, "masked_value", "xxxxtest"),
+				),
+			},
+			{
+				Config: testCircleCIEnvironmentVariableSecretConfig(project, envName, "secret-for-the-test-again"),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSecretValueHash(resourceName, "secret-for-the-test-again"),
+					resource.TestCheckResourceAttr(resourceName, "masked_value", "xxxxgain"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,182 @@
+package circleci
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
+)
+
+const (
+	checkoutKeyTypeDeployKey     = "deploy-key"
+	checkoutKeyTypeGitHubUserKey = "github-user-key"
+)
+
+func resourceCircleCICheckoutKey() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCircleCICheckoutKeyCreate,
+		Read:   resourceCircleCICheckoutKeyRead,
+		Delete: resourceCircleCICheckoutKeyDelete,
+
+		Importer: &schema.ResourceImporter{
+			State: resourceCircleCICheckoutKeyImport,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"project": {
+				Type:        schema.TypeString,
+				Description: "The name of the CircleCI project to create the checkout key for",
+				Required:    true,
+				ForceNew:    true,
+			},
+			"type": {
+				Type:         schema.TypeString,
+				Description:  "The type of checkout key, deploy-key or github-user-key. A github-user-key acts on behalf of the user owning the API token, which must be a personal API token",
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice([]string{checkoutKeyTypeDeployKey, checkoutKeyTypeGitHubUserKey}, false),
+			},
+			"public_key": {
+				Type:        schema.TypeString,
+				Description: "The public key, to be added to the repository or the user by CircleCI",
+				Computed:    true,
+			},
+			"fingerprint": {
+				Type:        schema.TypeString,
+				Description: "The MD5 fingerprint of the checkout key",
+				Computed:    true,
+			},
+			"preferred": {
+				Type:        schema.TypeBool,
+				Description: "Whether CircleCI uses this key to check out the project",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// checkoutKeyID builds the ID of a checkout key, its project and fingerprint separated by |
+func checkoutKeyID(projectName, fingerprint string) string {
+	return fmt.Sprintf("%s|%s", projectName, fingerprint)
+}
+
+// parseCheckoutKeyID splits a checkout key ID of the form project|fingerprint
+func parseCheckoutKeyID(id string) (projectName, fingerprint string, err error) {
+	parts := strings.Split(id, "|")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid checkout key ID %q, expected project|fingerprint", id)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func resourceCircleCICheckoutKeyCreate(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
+	projectName := d.Get("project").(string)
+	keyType := d.Get("type").(string)
+
+	if keyType == checkoutKeyTypeGitHubUserKey {
+		if err := providerClient.RequirePersonalToken(ctx, "creating a github-user-key checkout key"); err != nil {
+			return err
+		}
+	}
+
+	checkoutKey, err := providerClient.CreateCheckoutKey(ctx, projectName, keyType)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(checkoutKeyID(projectName, checkoutKey.Fingerprint))
+	if err := d.Set("fingerprint", checkoutKey.Fingerprint); err != nil {
+		return err
+	}
+
+	return resourceCircleCICheckoutKeyRead(d, m)
+}
+
+func resourceCircleCICheckoutKeyRead(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
+	projectName := d.Get("project").(string)
+	fingerprint := d.Get("fingerprint").(string)
+
+	checkoutKey, err := providerClient.GetCheckoutKey(ctx, projectName, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	if checkoutKey == nil || checkoutKey.Fingerprint == "" {
+		log.Printf("[WARN] checkout key %s not found in project %s, removing it from state", fingerprint, projectName)
+		d.SetId("")
+		return nil
+	}
+
+	if err := d.Set("type", checkoutKey.Type); err != nil {
+		return err
+	}
+	if err := d.Set("public_key", checkoutKey.PublicKey); err != nil {
+		return err
+	}
+	if err := d.Set("fingerprint", checkoutKey.Fingerprint); err != nil {
+		return err
+	}
+	if err := d.Set("preferred", checkoutKey.Preferred); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func resourceCircleCICheckoutKeyImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	projectName, fingerprint, err := parseCheckoutKeyID(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.Set("project", projectName); err != nil {
+		return nil, err
+	}
+	if err := d.Set("fingerprint", fingerprint); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceCircleCICheckoutKeyDelete(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
+	projectName := d.Get("project").(string)
+	fingerprint := d.Get("fingerprint").(string)
+
+	err := providerClient.DeleteCheckoutKey(ctx, projectName, fingerprint)
+	if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
+		return err
+	}
+
+	d.SetId("")
+
+	return nil
+}
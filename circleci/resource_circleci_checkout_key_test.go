@@ -0,0 +1,146 @@
+package circleci
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// testCheckoutKeyHandler serves a project with a single deploy key, created with any POST and counted in created
+// The first POST requests fail with a server error, after creating the key when their failure is true
+func testCheckoutKeyHandler(login string, created *int32, failures ...bool) http.HandlerFunc {
+	var mutex sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := `{"type":"deploy-key","fingerprint":"aa:bb:cc","public_key":"ssh-rsa AAAA","preferred":true}`
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch {
+		case r.URL.Path == "/api/v1.1/me":
+			w.Write([]byte(`{"login":"` + login + `"}`))
+		case r.Method == "GET" && r.URL.Path == "/api/v1.1/project/github/org/project/checkout-key":
+			if atomic.LoadInt32(created) == 0 {
+				w.Write([]byte(`[]`))
+				return
+			}
+			w.Write([]byte(`[` + key + `]`))
+		case r.Method == "POST" && r.URL.Path == "/api/v1.1/project/github/org/project/checkout-key":
+			if len(failures) > 0 {
+				if failures[0] {
+					atomic.AddInt32(created, 1)
+				}
+				failures = failures[1:]
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte(`{"message":"Bad gateway"}`))
+				return
+			}
+			atomic.AddInt32(created, 1)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(key))
+		case r.URL.Path == "/api/v1.1/project/github/org/project/checkout-key/aa:bb:cc":
+			w.Write([]byte(key))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not found"}`))
+		}
+	}
+}
+
+func TestResourceCircleCICheckoutKeyCreate(t *testing.T) {
+	var created int32
+	pv := testProviderClientFor(t, testCheckoutKeyHandler("", &created))
+
+	d := resourceCircleCICheckoutKey().TestResourceData()
+	d.Set("project", "project")
+	d.Set("type", checkoutKeyTypeDeployKey)
+
+	if err := resourceCircleCICheckoutKeyCreate(d, pv); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "project|aa:bb:cc" {
+		t.Errorf("unexpected ID %s", d.Id())
+	}
+	if d.Get("public_key") != "ssh-rsa AAAA" || d.Get("fingerprint") != "aa:bb:cc" || d.Get("preferred") != true {
+		t.Errorf("unexpected checkout key %v", d.State())
+	}
+
+	d = resourceCircleCICheckoutKey().TestResourceData()
+	d.Set("project", "project")
+	d.Set("type", checkoutKeyTypeGitHubUserKey)
+
+	err := resourceCircleCICheckoutKeyCreate(d, pv)
+	if err == nil || !strings.Contains(err.Error(), "personal API token") {
+		t.Errorf("expected a github-user-key to require a personal API token, got %v", err)
+	}
+	if atomic.LoadInt32(&created) != 1 {
+		t.Errorf("expected a single checkout key to be created, got %d", atomic.LoadInt32(&created))
+	}
+}
+
+func TestCreateCheckoutKeyRetry(t *testing.T) {
+	cases := map[string][]bool{
+		"failure before creating the key": {false},
+		"failure after creating the key":  {true},
+		"failures before and after":       {false, true},
+	}
+
+	for description, failures := range cases {
+		var created int32
+		pv := testProviderClientFor(t, testCheckoutKeyHandler("", &created, failures...))
+
+		checkoutKey, err := pv.CreateCheckoutKey(context.Background(), "project", checkoutKeyTypeDeployKey)
+		if err != nil {
+			t.Errorf("%s: %s", description, err)
+		} else if checkoutKey.Fingerprint != "aa:bb:cc" {
+			t.Errorf("%s: unexpected checkout key %v", description, checkoutKey)
+		}
+		if atomic.LoadInt32(&created) != 1 {
+			t.Errorf("%s: expected a single checkout key to be created, got %d", description, atomic.LoadInt32(&created))
+		}
+	}
+}
+
+func TestResourceCircleCICheckoutKeyImport(t *testing.T) {
+	var created int32
+	pv := testProviderClientFor(t, testCheckoutKeyHandler("user", &created))
+
+	cases := []struct {
+		id     string
+		exists bool
+	}{
+		{"project|aa:bb:cc", true},
+		{"project|dd:ee:ff", false},
+		{"missing|aa:bb:cc", false},
+	}
+
+	for _, c := range cases {
+		d := resourceCircleCICheckoutKey().TestResourceData()
+		d.SetId(c.id)
+
+		if _, err := resourceCircleCICheckoutKeyImport(d, pv); err != nil {
+			t.Errorf("%s: %s", c.id, err)
+			continue
+		}
+		if err := resourceCircleCICheckoutKeyRead(d, pv); err != nil {
+			t.Errorf("%s: %s", c.id, err)
+			continue
+		}
+
+		if exists := d.Id() != ""; exists != c.exists {
+			t.Errorf("%s: expected exists to be %t", c.id, c.exists)
+		}
+		if c.exists && d.Get("type") != checkoutKeyTypeDeployKey {
+			t.Errorf("%s: expected the type to be read, got %v", c.id, d.Get("type"))
+		}
+	}
+
+	for _, id := range []string{"", "aa:bb:cc", "project|", "|aa:bb:cc", "project|github.com|aa:bb:cc"} {
+		if _, _, err := parseCheckoutKeyID(id); err == nil {
+			t.Errorf("%q: expected an error", id)
+		}
+	}
+}
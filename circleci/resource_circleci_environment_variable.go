@@ -1,9 +1,13 @@
 package circleci
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
@@ -11,18 +15,35 @@ import (
 	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
 )
 
+const envVarMaskPrefix = "xxxx"
+
 func resourceCircleCIEnvironmentVariable() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceCircleCIEnvironmentVariableCreate,
 		Read:   resourceCircleCIEnvironmentVariableRead,
+		Update: resourceCircleCIEnvironmentVariableUpdate,
 		Delete: resourceCircleCIEnvironmentVariableDelete,
 		Exists: resourceCircleCIEnvironmentVariableExists,
+
+		CustomizeDiff: resourceCircleCIEnvironmentVariableCustomizeDiff,
+
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			State: resourceCircleCIEnvironmentVariableImport,
+		},
+
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceCircleCIEnvironmentVariableV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceCircleCIEnvironmentVariableStateUpgradeV0,
+			},
 		},
 
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
 			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 
@@ -34,28 +55,41 @@ func resourceCircleCIEnvironmentVariable() *schema.Resource {
 				ForceNew:    true,
 			},
 			"name": {
-				Description: "The name of the environment variable",
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				ValidateFunc: func(i interface{}, keyName string) (warnings []string, errors []error) {
-					v, ok := i.(string)
-					if !ok {
-						return nil, []error{fmt.Errorf("expected type of %s to be string", keyName)}
-					}
-					if !circleciapi.ValidateEnvVarName(v) {
-						return nil, []error{fmt.Errorf("environment variable name %s is not valid. See https://circleci.com/docs/2.0/env-vars/#injecting-environment-variables-with-the-api", v)}
-					}
-
-					return nil, nil
-				},
+				Description:  "The name of the environment variable",
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateEnvVarName,
 			},
 			"value": {
-				Description: "The value of the environment variable",
+				Description:   "The value of the environment variable",
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"secret_value"},
+			},
+			"secret_value": {
+				Description:      "The value of the environment variable. Unlike value, only a hash of it salted with secret_value_salt is written to the Terraform state",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Sensitive:        true,
+				DiffSuppressFunc: suppressSecretValueDiff,
+				ConflictsWith:    []string{"value"},
+			},
+			"secret_value_salt": {
+				Description: "The random salt of the secret_value hash, generated for each environment variable",
 				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Sensitive:   true,
+				Computed:    true,
+			},
+			"overwrite_existing": {
+				Description: "Take over the variable when it already exists in the project instead of failing, its value is overwritten. Defaults to the provider's overwrite_existing_environment_variables",
+				Type:        schema.TypeBool,
+				Optional:    true,
+			},
+			"masked_value": {
+				Description: "The value of the environment variable as masked by CircleCI, only its last four characters are shown",
+				Type:        schema.TypeString,
+				Computed:    true,
 			},
 		},
 	}
@@ -68,27 +102,171 @@ func hashString(str string) string {
 	return base64.StdEncoding.EncodeToString(hash[:])
 }
 
+// hashSecret is the state representation of secrets such as secret_value, a salted hash of the value
+// Each resource has its own random salt, so that the hashes cannot be looked up in precomputed
+// tables of common secrets
+func hashSecret(salt, value string) string {
+	if value == "" {
+		return ""
+	}
+	return hashString(salt + value)
+}
+
+// newSecretSalt generates a random salt for hashSecret
+func newSecretSalt() (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(salt), nil
+}
+
+// suppressSecretValueDiff compares the configured secret_value with the hash in state
+func suppressSecretValueDiff(k, old, new string, d *schema.ResourceData) bool {
+	if new == "" || old == "" {
+		return old == new
+	}
+	return hashSecret(d.Get("secret_value_salt").(string), new) == old
+}
+
+// setSecretValueHash replaces secret_value with its hash once the value has been sent to CircleCI
+func setSecretValueHash(d *schema.ResourceData) error {
+	value := d.Get("secret_value").(string)
+	if value == "" {
+		return nil
+	}
+
+	salt := d.Get("secret_value_salt").(string)
+	if salt == "" {
+		var err error
+		if salt, err = newSecretSalt(); err != nil {
+			return err
+		}
+		if err := d.Set("secret_value_salt", salt); err != nil {
+			return err
+		}
+	}
+
+	return d.Set("secret_value", hashSecret(salt, value))
+}
+
+// envVarValue returns the configured value of the environment variable, either value or secret_value
+func envVarValue(d *schema.ResourceData) string {
+	if v, ok := d.GetOk("secret_value"); ok {
+		return v.(string)
+	}
+	return d.Get("value").(string)
+}
+
+// envVarID builds the ID of an environment variable, the project name and the variable name
+func envVarID(projectName, envName string) string {
+	return projectName + "/" + envName
+}
+
+// parseEnvVarID splits an environment variable ID of the form [[vcs_type/]organization/]project/NAME
+// The VCS type and organization are empty when the ID does not include them
+func parseEnvVarID(id string) (vcsType, organization, projectName, envName string, err error) {
+	parts := strings.Split(id, "/")
+	for _, part := range parts {
+		if part == "" {
+			return "", "", "", "", fmt.Errorf("invalid environment variable ID %q, expected [[vcs_type/]organization/]project/NAME", id)
+		}
+	}
+
+	switch len(parts) {
+	case 2:
+		return "", "", parts[0], parts[1], nil
+	case 3:
+		return "", parts[0], parts[1], parts[2], nil
+	case 4:
+		return parts[0], parts[1], parts[2], parts[3], nil
+	default:
+		return "", "", "", "", fmt.Errorf("invalid environment variable ID %q, expected [[vcs_type/]organization/]project/NAME", id)
+	}
+}
+
+func resourceCircleCIEnvironmentVariableImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	providerClient := m.(*ProviderClient)
+
+	vcsType, organization, projectName, envName, err := parseEnvVarID(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	// resources are managed with the provider's VCS type and organization, importing
+	// a variable of another organization would leave it unmanageable
+	if vcsType != "" && vcsType != providerClient.vcsType {
+		return nil, fmt.Errorf("environment variable %q belongs to VCS type %q but the provider is configured for %q", d.Id(), vcsType, providerClient.vcsType)
+	}
+	if organization != "" && organization != providerClient.organization {
+		return nil, fmt.Errorf("environment variable %q belongs to organization %q but the provider is configured for %q", d.Id(), organization, providerClient.organization)
+	}
+
+	if err := d.Set("project", projectName); err != nil {
+		return nil, err
+	}
+	if err := d.Set("name", envName); err != nil {
+		return nil, err
+	}
+	d.SetId(envVarID(projectName, envName))
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// overwriteExistingEnvVar reports whether create takes over an existing variable
+// overwrite_existing falls back to the provider default when it is not set
+func overwriteExistingEnvVar(d *schema.ResourceData, providerClient *ProviderClient) bool {
+	if v, ok := d.GetOkExists("overwrite_existing"); ok {
+		return v.(bool)
+	}
+	return providerClient.overwriteExistingEnvVars
+}
+
+func resourceCircleCIEnvironmentVariableCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("value") || !d.NewValueKnown("secret_value") {
+		return nil
+	}
+
+	_, hasValue := d.GetOk("value")
+	_, hasSecretValue := d.GetOk("secret_value")
+	if !hasValue && !hasSecretValue {
+		return fmt.Errorf("one of value or secret_value must be set")
+	}
+
+	return nil
+}
+
 func resourceCircleCIEnvironmentVariableCreate(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
 	projectName := d.Get("project").(string)
 	envName := d.Get("name").(string)
-	envValue := d.Get("value").(string)
+	envValue := envVarValue(d)
 
-	exists, err := providerClient.EnvVarExists(projectName, envName)
+	exists, err := providerClient.EnvVarExists(ctx, projectName, envName)
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		return fmt.Errorf("environment variable '%s' already exists for project '%s'", envName, projectName)
+		if !overwriteExistingEnvVar(d, providerClient) {
+			return fmt.Errorf("environment variable '%s' already exists for project '%s', import it or set overwrite_existing to take it over", envName, projectName)
+		}
+		log.Printf("[INFO] environment variable %s already exists in project %s, overwriting it", envName, projectName)
 	}
 
-	if _, err := providerClient.AddEnvVar(projectName, envName, envValue); err != nil {
+	if _, err := providerClient.AddEnvVar(ctx, projectName, envName, envValue); err != nil {
 		return err
 	}
 
-	d.SetId(envName)
+	d.SetId(envVarID(projectName, envName))
+
+	if err := setSecretValueHash(d); err != nil {
+		return err
+	}
 
 	return resourceCircleCIEnvironmentVariableRead(d, m)
 }
@@ -96,31 +274,107 @@ func resourceCircleCIEnvironmentVariableCreate(d *schema.ResourceData, m interfa
 func resourceCircleCIEnvironmentVariableRead(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
 	projectName := d.Get("project").(string)
 	envName := d.Get("name").(string)
 
-	envVar, err := providerClient.GetEnvVar(projectName, envName)
+	envVar, err := providerClient.GetEnvVar(ctx, projectName, envName)
 	if err != nil {
 		return err
 	}
 
+	if envVar.Name == "" {
+		log.Printf("[WARN] environment variable %s not found in project %s, removing it from state", envName, projectName)
+		d.SetId("")
+		return nil
+	}
+
 	if err := d.Set("name", envVar.Name); err != nil {
 		return err
 	}
 
-	// environment variable value can only be set at creation since CircleCI API return hidden values : https://circleci.com/docs/api/#list-environment-variables
-	// also it is better to avoid storing sensitive value in terraform state if possible.
+	previousMaskedValue := d.Get("masked_value").(string)
+	if err := d.Set("masked_value", envVar.Value); err != nil {
+		return err
+	}
+
+	// CircleCI API only returns masked values: https://circleci.com/docs/api/#list-environment-variables
+	// but the last characters it shows are enough to notice a value changed outside of Terraform.
+	// Only a hash of secret_value is known, so it is compared with the previously seen masked value instead
+	if _, ok := d.GetOk("secret_value"); ok {
+		if previousMaskedValue != "" && previousMaskedValue != envVar.Value {
+			log.Printf("[WARN] environment variable %s of project %s was modified outside of Terraform", envName, projectName)
+			if err := d.Set("secret_value", ""); err != nil {
+				return err
+			}
+		}
+	} else if !maskedValueMatches(envVar.Value, d.Get("value").(string)) {
+		log.Printf("[WARN] environment variable %s of project %s was modified outside of Terraform", envName, projectName)
+		if err := d.Set("value", ""); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// maskedValueMatches reports whether value may be the value masked by CircleCI as masked
+// CircleCI masks values as "xxxx" followed by their last four characters
+func maskedValueMatches(masked, value string) bool {
+	if !strings.HasPrefix(masked, envVarMaskPrefix) {
+		// unknown masking format, nothing can be compared
+		return true
+	}
+
+	return strings.HasSuffix(value, strings.TrimPrefix(masked, envVarMaskPrefix))
+}
+
+func resourceCircleCIEnvironmentVariableUpdate(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	projectName := d.Get("project").(string)
+	envName := d.Get("name").(string)
+	envValue := envVarValue(d)
+
+	// overwrite_existing only matters on create
+	if !d.HasChange("value") && !d.HasChange("secret_value") {
+		return resourceCircleCIEnvironmentVariableRead(d, m)
+	}
+
+	// CircleCI overwrites an existing variable with the same name, so the value is
+	// replaced in place without any window where the variable is missing
+	if _, err := providerClient.AddEnvVar(ctx, projectName, envName, envValue); err != nil {
+		return err
+	}
+
+	if err := setSecretValueHash(d); err != nil {
+		return err
+	}
+
+	// the masked value is expected to change, it must not be mistaken for drift
+	if err := d.Set("masked_value", ""); err != nil {
+		return err
+	}
+
+	return resourceCircleCIEnvironmentVariableRead(d, m)
+}
+
 func resourceCircleCIEnvironmentVariableDelete(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
 	projectName := d.Get("project").(string)
 	envName := d.Get("name").(string)
 
-	err := providerClient.DeleteEnvVar(projectName, envName)
-	if err != nil {
+	err := providerClient.DeleteEnvVar(ctx, projectName, envName)
+	if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
 		return err
 	}
 
@@ -132,10 +386,13 @@ func resourceCircleCIEnvironmentVariableDelete(d *schema.ResourceData, m interfa
 func resourceCircleCIEnvironmentVariableExists(d *schema.ResourceData, m interface{}) (bool, error) {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
 	projectName := d.Get("project").(string)
 	envName := d.Get("name").(string)
 
-	envVar, err := providerClient.GetEnvVar(projectName, envName)
+	envVar, err := providerClient.GetEnvVar(ctx, projectName, envName)
 	if err != nil {
 		return false, err
 	}
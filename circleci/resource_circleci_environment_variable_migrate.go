@@ -0,0 +1,41 @@
+package circleci
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// resourceCircleCIEnvironmentVariableV0 is the schema of environment variables whose ID is only their name
+func resourceCircleCIEnvironmentVariableV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"project": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"value": {
+				Type:      schema.TypeString,
+				Required:  true,
+				ForceNew:  true,
+				Sensitive: true,
+			},
+		},
+	}
+}
+
+// resourceCircleCIEnvironmentVariableStateUpgradeV0 qualifies the name-only IDs with the project
+func resourceCircleCIEnvironmentVariableStateUpgradeV0(rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	projectName, _ := rawState["project"].(string)
+	envName, _ := rawState["name"].(string)
+
+	if projectName != "" && envName != "" {
+		rawState["id"] = envVarID(projectName, envName)
+	}
+
+	return rawState, nil
+}
@@ -0,0 +1,252 @@
+package circleci
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
+)
+
+func resourceCircleCIEnvironmentVariableSet() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCircleCIEnvironmentVariableSetCreate,
+		Read:   resourceCircleCIEnvironmentVariableSetRead,
+		Update: resourceCircleCIEnvironmentVariableSetUpdate,
+		Delete: resourceCircleCIEnvironmentVariableSetDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"projects": {
+				Description: "The names of the CircleCI projects to create the variable in. When the variable is created, the projects it cannot be written to are only logged as warnings and left out of the state, the next plan adds them again. Later failures are reported as errors",
+				Type:        schema.TypeSet,
+				Required:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Set:         schema.HashString,
+			},
+			"name": {
+				Description:  "The name of the environment variable",
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateEnvVarName,
+			},
+			"value": {
+				Description: "The value of the environment variable",
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+			},
+			"parallelism": {
+				Description:  "The maximum number of projects modified at the same time",
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      10,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"masked_values": {
+				Description: "The value of the environment variable as masked by CircleCI, by project",
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// sortedStrings returns the elements of a set of strings in order
+func sortedStrings(set *schema.Set) []string {
+	values := make([]string, 0, set.Len())
+	for _, value := range set.List() {
+		values = append(values, value.(string))
+	}
+	sort.Strings(values)
+	return values
+}
+
+func resourceCircleCIEnvironmentVariableSetCreate(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
+	envName := d.Get("name").(string)
+	envValue := d.Get("value").(string)
+	projects := d.Get("projects").(*schema.Set)
+
+	errs := forEachProject(ctx, sortedStrings(projects), d.Get("parallelism").(int), func(projectName string) error {
+		_, err := providerClient.AddEnvVar(ctx, projectName, envName, envValue)
+		return err
+	})
+
+	if len(errs) > 0 && len(errs) == projects.Len() {
+		return projectErrors(fmt.Sprintf("create environment variable %s", envName), errs)
+	}
+
+	// the same variable may be managed by several sets, each of them needs its own ID
+	d.SetId(resource.UniqueId())
+
+	// only the projects the variable was written to are recorded, the next apply retries the others
+	// Failing would taint the set, and replacing it would delete the variable from every project
+	if len(errs) > 0 {
+		for projectName := range errs {
+			projects.Remove(projectName)
+		}
+		if err := d.Set("projects", projects); err != nil {
+			return err
+		}
+		log.Printf("[WARN] %s", projectErrors(fmt.Sprintf("create environment variable %s", envName), errs))
+		return nil
+	}
+
+	return resourceCircleCIEnvironmentVariableSetRead(d, m)
+}
+
+func resourceCircleCIEnvironmentVariableSetRead(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
+	envName := d.Get("name").(string)
+	envValue := d.Get("value").(string)
+	projects := d.Get("projects").(*schema.Set)
+
+	var mutex sync.Mutex
+	maskedValues := map[string]interface{}{}
+	errs := forEachProject(ctx, sortedStrings(projects), d.Get("parallelism").(int), func(projectName string) error {
+		envVar, err := providerClient.GetEnvVar(ctx, projectName, envName)
+		if err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// projects missing the variable, or where it was modified outside of Terraform, are
+		// dropped from the state so that the next apply writes the variable to them again
+		switch {
+		case envVar.Name == "":
+			log.Printf("[WARN] environment variable %s not found in project %s", envName, projectName)
+			projects.Remove(projectName)
+		case !maskedValueMatches(envVar.Value, envValue):
+			log.Printf("[WARN] environment variable %s of project %s was modified outside of Terraform", envName, projectName)
+			projects.Remove(projectName)
+		default:
+			maskedValues[projectName] = envVar.Value
+		}
+		return nil
+	})
+	if err := projectErrors(fmt.Sprintf("read environment variable %s", envName), errs); err != nil {
+		return err
+	}
+
+	if err := d.Set("projects", projects); err != nil {
+		return err
+	}
+	if err := d.Set("masked_values", maskedValues); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func resourceCircleCIEnvironmentVariableSetUpdate(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	envName := d.Get("name").(string)
+	envValue := d.Get("value").(string)
+	parallelism := d.Get("parallelism").(int)
+
+	o, n := d.GetChange("projects")
+	oldProjects, newProjects := o.(*schema.Set), n.(*schema.Set)
+
+	added := newProjects.Difference(oldProjects)
+	if d.HasChange("value") {
+		added = newProjects
+	}
+	removed := oldProjects.Difference(newProjects)
+
+	writeErrs := forEachProject(ctx, sortedStrings(added), parallelism, func(projectName string) error {
+		_, err := providerClient.AddEnvVar(ctx, projectName, envName, envValue)
+		return err
+	})
+	deleteErrs := forEachProject(ctx, sortedStrings(removed), parallelism, func(projectName string) error {
+		err := providerClient.DeleteEnvVar(ctx, projectName, envName)
+		if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+
+	if len(writeErrs) > 0 || len(deleteErrs) > 0 {
+		// the state records where the variable actually is, so the next apply retries the failures
+		projects := newProjects
+		for projectName := range writeErrs {
+			projects.Remove(projectName)
+		}
+		for projectName := range deleteErrs {
+			projects.Add(projectName)
+		}
+		if err := d.Set("projects", projects); err != nil {
+			return err
+		}
+
+		for projectName, err := range deleteErrs {
+			writeErrs[projectName] = err
+		}
+		return projectErrors(fmt.Sprintf("update environment variable %s", envName), writeErrs)
+	}
+
+	return resourceCircleCIEnvironmentVariableSetRead(d, m)
+}
+
+func resourceCircleCIEnvironmentVariableSetDelete(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
+	envName := d.Get("name").(string)
+	projects := d.Get("projects").(*schema.Set)
+
+	errs := forEachProject(ctx, sortedStrings(projects), d.Get("parallelism").(int), func(projectName string) error {
+		err := providerClient.DeleteEnvVar(ctx, projectName, envName)
+		if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+
+	if len(errs) > 0 {
+		// keep the projects the variable could not be deleted from
+		remaining := schema.NewSet(schema.HashString, nil)
+		for projectName := range errs {
+			remaining.Add(projectName)
+		}
+		if err := d.Set("projects", remaining); err != nil {
+			return err
+		}
+		return projectErrors(fmt.Sprintf("delete environment variable %s", envName), errs)
+	}
+
+	d.SetId("")
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package circleci
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
+)
+
+// testEnvVarSetHandler serves the environment variables of the given projects, masked by their last 4 characters
+// Any request to a project whose name starts with broken is rejected
+func testEnvVarSetHandler(envVars map[string]map[string]string) http.HandlerFunc {
+	var mutex sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1.1/project/github/org/"), "/")
+		if len(parts) < 2 || parts[1] != "envvar" || strings.HasPrefix(parts[0], "broken") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Permission denied"}`))
+			return
+		}
+		projectName := parts[0]
+
+		switch {
+		case r.Method == "GET" && len(parts) == 2:
+			list := []circleciapi.EnvVar{}
+			for name, value := range envVars[projectName] {
+				list = append(list, circleciapi.EnvVar{Name: name, Value: envVarMaskPrefix + value[len(value)-4:]})
+			}
+			json.NewEncoder(w).Encode(list)
+		case r.Method == "POST" && len(parts) == 2:
+			var envVar circleciapi.EnvVar
+			json.NewDecoder(r.Body).Decode(&envVar)
+			if envVars[projectName] == nil {
+				envVars[projectName] = map[string]string{}
+			}
+			envVars[projectName][envVar.Name] = envVar.Value
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(envVar)
+		case r.Method == "DELETE" && len(parts) == 3:
+			delete(envVars[projectName], parts[2])
+			w.Write([]byte(`{"message":"OK"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not found"}`))
+		}
+	}
+}
+
+// testEnvVarSetState is the state of a set of the TOKEN variable in the given projects
+func testEnvVarSetState(t *testing.T, value string, projects ...string) *terraform.InstanceState {
+	d := resourceCircleCIEnvironmentVariableSet().TestResourceData()
+	d.SetId("set")
+	d.Set("name", "TOKEN")
+	d.Set("value", value)
+	d.Set("parallelism", 10)
+	if err := d.Set("projects", projects); err != nil {
+		t.Fatal(err)
+	}
+	return d.State()
+}
+
+// testEnvVarSetApply plans and applies the configuration of a set of the TOKEN variable over the given state
+func testEnvVarSetApply(t *testing.T, pv *ProviderClient, state *terraform.InstanceState, value string, projects ...string) (*terraform.InstanceState, error) {
+	raw, err := config.NewRawConfig(map[string]interface{}{
+		"name":     "TOKEN",
+		"value":    value,
+		"projects": projects,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := resourceCircleCIEnvironmentVariableSet()
+	diff, err := r.Diff(state, terraform.NewResourceConfig(raw), pv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r.Apply(state, diff, pv)
+}
+
+// testEnvVarSetProjects returns the projects of the state, in order
+func testEnvVarSetProjects(state *terraform.InstanceState) []string {
+	d := resourceCircleCIEnvironmentVariableSet().Data(state)
+	return sortedStrings(d.Get("projects").(*schema.Set))
+}
+
+func TestResourceCircleCIEnvironmentVariableSetCreate(t *testing.T) {
+	envVars := map[string]map[string]string{}
+	pv := testProviderClientFor(t, testEnvVarSetHandler(envVars))
+
+	state, err := testEnvVarSetApply(t, pv, nil, "secret-1234", "api", "broken", "web")
+	if err != nil {
+		t.Fatalf("expected the failures of some projects not to fail the set, got %v", err)
+	}
+	if state == nil || state.ID == "" || state.ID == "TOKEN" {
+		t.Fatalf("expected the set to have a unique ID, got %v", state)
+	}
+	if expected := []string{"api", "web"}; !reflect.DeepEqual(testEnvVarSetProjects(state), expected) {
+		t.Errorf("expected the projects %v, got %v", expected, testEnvVarSetProjects(state))
+	}
+	if envVars["api"]["TOKEN"] != "secret-1234" || envVars["web"]["TOKEN"] != "secret-1234" {
+		t.Errorf("unexpected environment variables %v", envVars)
+	}
+
+	other, err := testEnvVarSetApply(t, pv, nil, "secret-1234", "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == state.ID {
+		t.Errorf("expected sets of the same variable to have distinct IDs, got %s", other.ID)
+	}
+
+	state, err = testEnvVarSetApply(t, pv, nil, "secret-1234", "broken", "broken-too")
+	if err == nil || !strings.Contains(err.Error(), "2 project(s)") {
+		t.Errorf("expected an error when the variable cannot be created in any project, got %v", err)
+	}
+	if state != nil && state.ID != "" {
+		t.Errorf("expected no set to be created, got %v", state)
+	}
+}
+
+func TestResourceCircleCIEnvironmentVariableSetUpdate(t *testing.T) {
+	envVars := map[string]map[string]string{
+		"api": {"TOKEN": "secret-1234"},
+		"web": {"TOKEN": "secret-1234"},
+	}
+	pv := testProviderClientFor(t, testEnvVarSetHandler(envVars))
+
+	state := testEnvVarSetState(t, "secret-1234", "api", "broken-old", "web")
+
+	state, err := testEnvVarSetApply(t, pv, state, "secret-5678", "api", "broken-new", "worker")
+	if err == nil || !strings.Contains(err.Error(), "broken-new") || !strings.Contains(err.Error(), "broken-old") {
+		t.Errorf("expected the failures to be reported by project, got %v", err)
+	}
+	if state == nil {
+		t.Fatal("expected the state to be kept")
+	}
+
+	// the variable could not be written to broken-new nor deleted from broken-old
+	if expected := []string{"api", "broken-old", "worker"}; !reflect.DeepEqual(testEnvVarSetProjects(state), expected) {
+		t.Errorf("expected the projects %v, got %v", expected, testEnvVarSetProjects(state))
+	}
+	if envVars["api"]["TOKEN"] != "secret-5678" || envVars["worker"]["TOKEN"] != "secret-5678" {
+		t.Errorf("unexpected environment variables %v", envVars)
+	}
+	if _, ok := envVars["web"]["TOKEN"]; ok {
+		t.Error("expected the variable to be deleted from web")
+	}
+}
+
+func TestResourceCircleCIEnvironmentVariableSetRead(t *testing.T) {
+	envVars := map[string]map[string]string{
+		"api":     {"TOKEN": "secret-1234"},
+		"drifted": {"TOKEN": "secret-0000"},
+		"missing": {},
+	}
+	pv := testProviderClientFor(t, testEnvVarSetHandler(envVars))
+
+	r := resourceCircleCIEnvironmentVariableSet()
+
+	state, err := r.Refresh(testEnvVarSetState(t, "secret-1234", "api", "drifted", "missing"), pv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"api"}; !reflect.DeepEqual(testEnvVarSetProjects(state), expected) {
+		t.Errorf("expected the projects %v, got %v", expected, testEnvVarSetProjects(state))
+	}
+	if masked := r.Data(state).Get("masked_values"); !reflect.DeepEqual(masked, map[string]interface{}{"api": "xxxx1234"}) {
+		t.Errorf("unexpected masked values %v", masked)
+	}
+
+	_, err = r.Refresh(testEnvVarSetState(t, "secret-1234", "api", "broken"), pv)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected the projects which cannot be read to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package circleci
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestMaskedValueMatches(t *testing.T) {
+	cases := []struct {
+		masked, value string
+		expected      bool
+	}{
+		{"xxxxabcd", "secret-abcd", true},
+		{"xxxxabcd", "abcd", true},
+		{"xxxxabcd", "secret-abce", false},
+		{"xxxxabcd", "cd", false},
+		{"xxxxabcd", "", false},
+		{"xxxx", "a", true},
+		{"****abcd", "anything", true},
+	}
+
+	for _, c := range cases {
+		if got := maskedValueMatches(c.masked, c.value); got != c.expected {
+			t.Errorf("%q against %q: expected %t, got %t", c.value, c.masked, c.expected, got)
+		}
+	}
+}
+
+func TestHashEnvVarValue(t *testing.T) {
+	hash := hashSecret("salt", "super-secret")
+
+	if hash == "" || strings.Contains(hash, "super-secret") {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	if hash == hashString("super-secret") {
+		t.Error("expected the hash to be salted")
+	}
+	if hashSecret("salt", "super-secret") != hash {
+		t.Error("expected the hash to be stable")
+	}
+	if hashSecret("other-salt", "super-secret") == hash {
+		t.Error("expected different salts to give different hashes")
+	}
+	if hashSecret("salt", "other-secret") == hash {
+		t.Error("expected different values to have different hashes")
+	}
+	if hashSecret("salt", "") != "" {
+		t.Error("expected an empty value to have an empty hash")
+	}
+}
+
+func TestNewEnvVarHashSalt(t *testing.T) {
+	salt, err := newSecretSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newSecretSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if salt == "" || salt == other {
+		t.Errorf("expected distinct random salts, got %q and %q", salt, other)
+	}
+}
+
+func TestSuppressSecretValueDiff(t *testing.T) {
+	cases := []struct {
+		salt, old, new string
+		expected       bool
+	}{
+		{"salt", hashSecret("salt", "super-secret"), "super-secret", true},
+		{"salt", hashSecret("salt", "super-secret"), "other-secret", false},
+		{"salt", hashSecret("other-salt", "super-secret"), "super-secret", false},
+		{"salt", hashSecret("salt", "super-secret"), "", false},
+		{"salt", "", "super-secret", false},
+		{"", "", "", true},
+	}
+
+	r := resourceCircleCIEnvironmentVariable()
+	for _, c := range cases {
+		d := r.Data(&terraform.InstanceState{
+			ID: "project/NAME",
+			Attributes: map[string]string{
+				"secret_value":      c.old,
+				"secret_value_salt": c.salt,
+			},
+		})
+
+		if got := suppressSecretValueDiff("secret_value", c.old, c.new, d); got != c.expected {
+			t.Errorf("%q against %q with salt %q: expected %t, got %t", c.new, c.old, c.salt, c.expected, got)
+		}
+	}
+}
+
+func TestParseEnvVarID(t *testing.T) {
+	cases := []struct {
+		id                                       string
+		vcsType, organization, projectName, name string
+		valid                                    bool
+	}{
+		{"project/NAME", "", "", "project", "NAME", true},
+		{"org/project/NAME", "", "org", "project", "NAME", true},
+		{"github/org/project/NAME", "github", "org", "project", "NAME", true},
+		{"NAME", "", "", "", "", false},
+		{"project/", "", "", "", "", false},
+		{"/NAME", "", "", "", "", false},
+		{"a/github/org/project/NAME", "", "", "", "", false},
+	}
+
+	for _, c := range cases {
+		vcsType, organization, projectName, name, err := parseEnvVarID(c.id)
+		if !c.valid {
+			if err == nil {
+				t.Errorf("%q: expected an error", c.id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", c.id, err)
+			continue
+		}
+		if vcsType != c.vcsType || organization != c.organization || projectName != c.projectName || name != c.name {
+			t.Errorf("%q: unexpected %q %q %q %q", c.id, vcsType, organization, projectName, name)
+		}
+	}
+}
+
+func TestResourceCircleCIEnvironmentVariableStateUpgradeV0(t *testing.T) {
+	rawState := map[string]interface{}{
+		"id":      "NAME",
+		"project": "project",
+		"name":    "NAME",
+		"value":   "value",
+	}
+
+	upgraded, err := resourceCircleCIEnvironmentVariableStateUpgradeV0(rawState, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgraded["id"] != "project/NAME" {
+		t.Errorf("expected the ID to be qualified with the project, got %v", upgraded["id"])
+	}
+	if upgraded["value"] != "value" {
+		t.Errorf("expected the other attributes to be kept, got %v", upgraded)
+	}
+}
+
+func TestOverwriteExistingEnvVar(t *testing.T) {
+	cases := []struct {
+		config          map[string]interface{}
+		providerDefault bool
+		expected        bool
+	}{
+		{map[string]interface{}{}, false, false},
+		{map[string]interface{}{}, true, true},
+		{map[string]interface{}{"overwrite_existing": true}, false, true},
+		{map[string]interface{}{"overwrite_existing": false}, true, false},
+	}
+
+	for _, c := range cases {
+		c.config["project"] = "project"
+		c.config["name"] = "NAME"
+		c.config["value"] = "value"
+		d := schema.TestResourceDataRaw(t, resourceCircleCIEnvironmentVariable().Schema, c.config)
+
+		if got := overwriteExistingEnvVar(d, &ProviderClient{overwriteExistingEnvVars: c.providerDefault}); got != c.expected {
+			t.Errorf("%v with provider default %t: expected %t, got %t", c.config, c.providerDefault, c.expected, got)
+		}
+	}
+}
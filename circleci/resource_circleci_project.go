@@ -1,7 +1,13 @@
 package circleci
 
 import (
+	"errors"
+	"log"
+	"time"
+
 	"github.com/hashicorp/terraform/helper/schema"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
 )
 
 func resourceCircleCIProject() *schema.Resource {
@@ -11,6 +17,12 @@ func resourceCircleCIProject() *schema.Resource {
 		Delete: resourceCircleCIProjectDelete,
 		Exists: resourceCircleCIProjectExists,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"repo": {
 				Type:        schema.TypeString,
@@ -29,14 +41,17 @@ func resourceCircleCIProject() *schema.Resource {
 func resourceCircleCIProjectCreate(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
 	name := d.Get("repo").(string)
 
-	_, err := providerClient.FollowProject(name)
+	_, err := providerClient.FollowProject(ctx, name)
 	if err != nil {
 		return err
 	}
 
-	err = providerClient.EnableProject(name)
+	err = providerClient.EnableProject(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -49,13 +64,22 @@ func resourceCircleCIProjectCreate(d *schema.ResourceData, m interface{}) error
 func resourceCircleCIProjectRead(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
 	name := d.Get("repo").(string)
 
-	_, err := providerClient.GetProject(name)
+	project, err := providerClient.GetFollowedProject(ctx, name)
 	if err != nil {
 		return err
 	}
 
+	if project == nil {
+		log.Printf("[WARN] project %s is not followed anymore, removing it from state", name)
+		d.SetId("")
+		return nil
+	}
+
 	d.SetId(name)
 
 	return nil
@@ -64,10 +88,13 @@ func resourceCircleCIProjectRead(d *schema.ResourceData, m interface{}) error {
 func resourceCircleCIProjectDelete(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
 	name := d.Get("repo").(string)
 
-	err := providerClient.DisableProject(name)
-	if err != nil {
+	err := providerClient.DisableProject(ctx, name)
+	if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
 		return err
 	}
 
@@ -79,9 +106,12 @@ func resourceCircleCIProjectDelete(d *schema.ResourceData, m interface{}) error
 func resourceCircleCIProjectExists(d *schema.ResourceData, m interface{}) (bool, error) {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
 	name := d.Get("repo").(string)
 
-	project, err := providerClient.GetProject(name)
+	project, err := providerClient.GetFollowedProject(ctx, name)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,230 @@
+package circleci
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
+)
+
+func resourceCircleCIProjectEnvironment() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCircleCIProjectEnvironmentCreate,
+		Read:   resourceCircleCIProjectEnvironmentRead,
+		Update: resourceCircleCIProjectEnvironmentUpdate,
+		Delete: resourceCircleCIProjectEnvironmentDelete,
+
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"project": {
+				Description: "The name of the CircleCI project owning the environment variables",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+			},
+			"variables": {
+				Description: "The environment variables of the project, by name. Any other variable of the project is deleted",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Sensitive:   true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ValidateFunc: func(i interface{}, keyName string) (warnings []string, errors []error) {
+					variables, ok := i.(map[string]interface{})
+					if !ok {
+						return nil, []error{fmt.Errorf("expected type of %s to be a map", keyName)}
+					}
+					for name := range variables {
+						_, nameErrors := validateEnvVarName(name, keyName)
+						errors = append(errors, nameErrors...)
+					}
+
+					return nil, errors
+				},
+			},
+			"ignore_prefixes": {
+				Description: "Variables of the project whose name starts with one of these prefixes are left alone unless they are declared in variables",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"masked_values": {
+				Description: "The values of the environment variables as masked by CircleCI, by name",
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// ignoredEnvVar reports whether name starts with one of the ignored prefixes
+func ignoredEnvVar(name string, ignorePrefixes []interface{}) bool {
+	for _, prefix := range ignorePrefixes {
+		if prefix, ok := prefix.(string); ok && prefix != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectEnvironmentChanges returns the variables to write and the variables to delete, sorted by name,
+// for the project to have exactly the given variables
+// Variables which exist and whose value did not change since the previous apply are not written again
+func projectEnvironmentChanges(remote map[string]circleciapi.EnvVar, previous, variables map[string]interface{}, ignorePrefixes []interface{}) (set, remove []string) {
+	for name, value := range variables {
+		previousValue, ok := previous[name]
+		if _, exists := remote[name]; !exists || !ok || previousValue != value {
+			set = append(set, name)
+		}
+	}
+
+	for name := range remote {
+		if _, ok := variables[name]; ok || ignoredEnvVar(name, ignorePrefixes) {
+			continue
+		}
+		remove = append(remove, name)
+	}
+
+	sort.Strings(set)
+	sort.Strings(remove)
+
+	return set, remove
+}
+
+// applyProjectEnvironment brings the variables of the project in line with the configuration
+func applyProjectEnvironment(d *schema.ResourceData, m interface{}, timeout time.Duration) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(timeout)
+	defer cancel()
+
+	projectName := d.Get("project").(string)
+
+	previous, variables := d.GetChange("variables")
+
+	remote, err := providerClient.ListEnvVars(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	set, remove := projectEnvironmentChanges(remote, previous.(map[string]interface{}), variables.(map[string]interface{}), d.Get("ignore_prefixes").([]interface{}))
+
+	for _, name := range remove {
+		log.Printf("[INFO] deleting environment variable %s of project %s, it is not declared in variables", name, projectName)
+		if err := providerClient.DeleteEnvVar(ctx, projectName, name); err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
+			return err
+		}
+	}
+
+	for _, name := range set {
+		if _, err := providerClient.AddEnvVar(ctx, projectName, name, variables.(map[string]interface{})[name].(string)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceCircleCIProjectEnvironmentCreate(d *schema.ResourceData, m interface{}) error {
+	if err := applyProjectEnvironment(d, m, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return err
+	}
+
+	d.SetId(d.Get("project").(string))
+
+	return resourceCircleCIProjectEnvironmentRead(d, m)
+}
+
+func resourceCircleCIProjectEnvironmentRead(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
+	projectName := d.Id()
+
+	remote, err := providerClient.ListEnvVars(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	previous := d.Get("variables").(map[string]interface{})
+	ignorePrefixes := d.Get("ignore_prefixes").([]interface{})
+
+	// CircleCI only returns masked values, a value is kept as long as the masked value may
+	// still be the one applied. Otherwise, as for variables created outside of Terraform,
+	// its value is unknown and the next apply overwrites or deletes it
+	variables := map[string]interface{}{}
+	maskedValues := map[string]interface{}{}
+	for name, envVar := range remote {
+		value, managed := previous[name]
+		if !managed && ignoredEnvVar(name, ignorePrefixes) {
+			continue
+		}
+
+		maskedValues[name] = envVar.Value
+		if managed && maskedValueMatches(envVar.Value, value.(string)) {
+			variables[name] = value
+			continue
+		}
+
+		log.Printf("[WARN] environment variable %s of project %s was modified outside of Terraform", name, projectName)
+		variables[name] = ""
+	}
+
+	if err := d.Set("project", projectName); err != nil {
+		return err
+	}
+	if err := d.Set("variables", variables); err != nil {
+		return err
+	}
+	if err := d.Set("masked_values", maskedValues); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func resourceCircleCIProjectEnvironmentUpdate(d *schema.ResourceData, m interface{}) error {
+	if err := applyProjectEnvironment(d, m, d.Timeout(schema.TimeoutUpdate)); err != nil {
+		return err
+	}
+
+	return resourceCircleCIProjectEnvironmentRead(d, m)
+}
+
+func resourceCircleCIProjectEnvironmentDelete(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
+	projectName := d.Get("project").(string)
+
+	for name := range d.Get("variables").(map[string]interface{}) {
+		err := providerClient.DeleteEnvVar(ctx, projectName, name)
+		if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
+			return err
+		}
+	}
+
+	d.SetId("")
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package circleci
+
+import (
+	"reflect"
+	"testing"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
+)
+
+func TestProjectEnvironmentChanges(t *testing.T) {
+	remote := map[string]circleciapi.EnvVar{
+		"UNCHANGED": {Name: "UNCHANGED", Value: "xxxx1111"},
+		"CHANGED":   {Name: "CHANGED", Value: "xxxx2222"},
+		"UNKNOWN":   {Name: "UNKNOWN", Value: "xxxx3333"},
+		"UNMANAGED": {Name: "UNMANAGED", Value: "xxxx4444"},
+		"CI_TOKEN":  {Name: "CI_TOKEN", Value: "xxxx5555"},
+	}
+	previous := map[string]interface{}{
+		"UNCHANGED": "1111",
+		"CHANGED":   "2222",
+		"UNKNOWN":   "",
+		"DELETED":   "6666",
+	}
+	variables := map[string]interface{}{
+		"UNCHANGED": "1111",
+		"CHANGED":   "new-2222",
+		"UNKNOWN":   "3333",
+		"DELETED":   "6666",
+		"NEW":       "7777",
+	}
+
+	set, remove := projectEnvironmentChanges(remote, previous, variables, []interface{}{"CI_"})
+
+	if expected := []string{"CHANGED", "DELETED", "NEW", "UNKNOWN"}; !reflect.DeepEqual(set, expected) {
+		t.Errorf("expected to set %v, got %v", expected, set)
+	}
+	if expected := []string{"UNMANAGED"}; !reflect.DeepEqual(remove, expected) {
+		t.Errorf("expected to remove %v, got %v", expected, remove)
+	}
+}
+
+func TestIgnoredEnvVar(t *testing.T) {
+	prefixes := []interface{}{"CI_", ""}
+
+	if !ignoredEnvVar("CI_TOKEN", prefixes) {
+		t.Error("expected CI_TOKEN to be ignored")
+	}
+	if ignoredEnvVar("TOKEN", prefixes) {
+		t.Error("expected an empty prefix not to ignore every variable")
+	}
+}
@@ -1,13 +1,24 @@
 package circleci
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+
+	circleciapi "github.com/andrewstucki/terraform-provider-circleci/circleci/client"
 )
 
 func resourceCircleCISSHKey() *schema.Resource {
@@ -16,6 +27,14 @@ func resourceCircleCISSHKey() *schema.Resource {
 		Read:   resourceCircleCISSHKeyRead,
 		Delete: resourceCircleCISSHKeyDelete,
 
+		CustomizeDiff: resourceCircleCISSHKeyCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"project": {
 				Type:        schema.TypeString,
@@ -30,72 +49,450 @@ func resourceCircleCISSHKey() *schema.Resource {
 				ForceNew:    true,
 			},
 			"private_key": {
+				Type:             schema.TypeString,
+				Description:      "The SSH private key, PEM encoded in the OpenSSH, PKCS#1, PKCS#8 or SEC 1 format",
+				Optional:         true,
+				ForceNew:         true,
+				Sensitive:        true,
+				ValidateFunc:     validateSSHPrivateKey,
+				ConflictsWith:    []string{"key_algorithm"},
+				DiffSuppressFunc: suppressImportedSSHKeyDiff,
+			},
+			"passphrase": {
+				Type:             schema.TypeString,
+				Description:      "The passphrase of an encrypted private_key. The key is decrypted in memory and only the decrypted key is sent to CircleCI. Only a hash of the passphrase salted with passphrase_salt is written to the Terraform state",
+				Optional:         true,
+				ForceNew:         true,
+				Sensitive:        true,
+				ConflictsWith:    []string{"key_algorithm"},
+				DiffSuppressFunc: suppressPassphraseDiff,
+			},
+			"passphrase_salt": {
 				Type:        schema.TypeString,
-				Description: "The SSH private key",
-				Required:    true,
-				ForceNew:    true,
-				Sensitive:   true,
+				Description: "The random salt of the passphrase hash, generated for each SSH key",
+				Computed:    true,
+			},
+			"key_algorithm": {
+				Type:          schema.TypeString,
+				Description:   "Generate the SSH key in the provider instead of setting private_key, either ed25519 or rsa. The private key is only sent to CircleCI",
+				Optional:      true,
+				ForceNew:      true,
+				ValidateFunc:  validation.StringInSlice([]string{sshKeyAlgorithmED25519, sshKeyAlgorithmRSA}, false),
+				ConflictsWith: []string{"private_key"},
+			},
+			// no schema default, existing keys would otherwise be replaced to record it
+			"rsa_bits": {
+				Type:             schema.TypeInt,
+				Description:      "The size of the generated RSA keys, 4096 by default",
+				Optional:         true,
+				ForceNew:         true,
+				ValidateFunc:     validation.IntBetween(2048, 8192),
+				DiffSuppressFunc: suppressRSABitsDiff,
 			},
 			"fingerprint": {
-				Type:     schema.TypeString,
-				Computed: true,
+				Type:        schema.TypeString,
+				Description: "The MD5 fingerprint of the SSH key, as shown by CircleCI",
+				Computed:    true,
+			},
+			"fingerprint_sha256": {
+				Type:        schema.TypeString,
+				Description: "The SHA256 fingerprint of the SSH key",
+				Computed:    true,
+			},
+			"public_key": {
+				Type:        schema.TypeString,
+				Description: "The public key, in the authorized_keys format",
+				Computed:    true,
+			},
+			"key_type": {
+				Type:        schema.TypeString,
+				Description: "The type of the SSH key, e.g. ssh-ed25519 or ssh-rsa",
+				Computed:    true,
+			},
+			"public_key_openssh": {
+				Type:        schema.TypeString,
+				Description: "The public key as an OpenSSH public key file, commented with the project and hostname",
+				Computed:    true,
 			},
 		},
 
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			State: resourceCircleCISSHKeyImport,
 		},
 	}
 }
 
+const (
+	sshKeyAlgorithmED25519 = "ed25519"
+	sshKeyAlgorithmRSA     = "rsa"
+
+	defaultSSHKeyRSABits = 4096
+)
+
+// generateSSHPrivateKey generates a private key, PEM encoded in the OpenSSH format for ed25519 and PKCS#1 for RSA
+func generateSSHPrivateKey(algorithm string, rsaBits int) (string, error) {
+	var block *pem.Block
+	switch algorithm {
+	case sshKeyAlgorithmED25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		block, err = ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return "", err
+		}
+	case sshKeyAlgorithmRSA:
+		if rsaBits == 0 {
+			rsaBits = defaultSSHKeyRSABits
+		}
+		key, err := rsa.GenerateKey(rand.Reader, rsaBits)
+		if err != nil {
+			return "", err
+		}
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	default:
+		return "", fmt.Errorf("unsupported key algorithm %q", algorithm)
+	}
+
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// sshPublicKeyComment identifies the keys in public_key_openssh
+func sshPublicKeyComment(projectName, hostname string) string {
+	return fmt.Sprintf("circleci-%s@%s", projectName, hostname)
+}
+
+// setSSHPublicKey records the public key and its fingerprints
+func setSSHPublicKey(d *schema.ResourceData, pubKey ssh.PublicKey) error {
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+	comment := sshPublicKeyComment(d.Get("project").(string), d.Get("hostname").(string))
+
+	if err := d.Set("fingerprint", ssh.FingerprintLegacyMD5(pubKey)); err != nil {
+		return err
+	}
+	if err := d.Set("fingerprint_sha256", ssh.FingerprintSHA256(pubKey)); err != nil {
+		return err
+	}
+	if err := d.Set("public_key", authorizedKey); err != nil {
+		return err
+	}
+	if err := d.Set("public_key_openssh", authorizedKey+" "+comment+"\n"); err != nil {
+		return err
+	}
+	if err := d.Set("key_type", pubKey.Type()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func resourceCircleCISSHKeyCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("private_key") || !d.NewValueKnown("key_algorithm") {
+		return nil
+	}
+
+	_, hasPrivateKey := d.GetOk("private_key")
+	_, hasKeyAlgorithm := d.GetOk("key_algorithm")
+	if !hasPrivateKey && !hasKeyAlgorithm && d.Id() == "" {
+		return fmt.Errorf("one of private_key or key_algorithm must be set")
+	}
+
+	// encrypted keys can only be checked once the passphrase is known
+	// The state only has a hash of the passphrase, but both are ForceNew: once either changes,
+	// the diff is computed again as for a new key, with the configured passphrase
+	if hasPrivateKey && d.NewValueKnown("passphrase") && d.Id() == "" {
+		if _, err := parseSSHPrivateKey(d.Get("private_key").(string), d.Get("passphrase").(string)); err != nil {
+			return fmt.Errorf("private_key: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// suppressRSABitsDiff ignores rsa_bits unless an RSA key is generated
+func suppressRSABitsDiff(k, old, new string, d *schema.ResourceData) bool {
+	return d.Get("key_algorithm").(string) != sshKeyAlgorithmRSA
+}
+
+// suppressPassphraseDiff compares the configured passphrase with the hash in state
+func suppressPassphraseDiff(k, old, new string, d *schema.ResourceData) bool {
+	if old != "" && new != "" && hashSecret(d.Get("passphrase_salt").(string), new) == old {
+		return true
+	}
+	return suppressImportedSSHKeyDiff(k, old, new, d)
+}
+
+// suppressImportedSSHKeyDiff ignores the private key and passphrase of imported keys
+// Imported keys have no private key in state, the configured one is only a change
+// when it is not the imported key
+func suppressImportedSSHKeyDiff(k, old, new string, d *schema.ResourceData) bool {
+	if previous, _ := d.GetChange("private_key"); previous.(string) != "" || old != "" {
+		return false
+	}
+
+	pubKey, err := parseSSHPrivateKey(d.Get("private_key").(string), d.Get("passphrase").(string))
+	return err == nil && ssh.FingerprintLegacyMD5(pubKey) == d.Get("fingerprint").(string)
+}
+
+// errSSHKeyEncrypted is returned for encrypted private keys without passphrase
+var errSSHKeyEncrypted = errors.New("private key is encrypted, set passphrase to decrypt it")
+
+// parseRawSSHPrivateKey parses a PEM encoded private key, decrypting it with passphrase when it is encrypted
+// RSA, ECDSA, Ed25519 and DSA keys are supported, in the OpenSSH, PKCS#1, PKCS#8 and SEC 1 formats
+func parseRawSSHPrivateKey(privateKey, passphrase string) (key interface{}, encrypted bool, err error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, false, errors.New("private key is not PEM encoded, expected a key starting with -----BEGIN ... PRIVATE KEY-----")
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, true, errors.New("encrypted PKCS#8 private keys are not supported, convert the key with ssh-keygen -p")
+	}
+
+	key, err = ssh.ParseRawPrivateKey([]byte(privateKey))
+	var passphraseMissing *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseMissing) {
+		if passphrase == "" {
+			return nil, true, errSSHKeyEncrypted
+		}
+
+		encrypted = true
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, true, errors.New("unable to decrypt private key, the passphrase is incorrect")
+		}
+	}
+	if err != nil {
+		return nil, encrypted, fmt.Errorf("unable to parse private key: %s", err)
+	}
+
+	return key, encrypted, nil
+}
+
+// parseSSHPrivateKey parses a PEM encoded private key, decrypting it with passphrase when it is encrypted,
+// and returns its public key
+func parseSSHPrivateKey(privateKey, passphrase string) (ssh.PublicKey, error) {
+	key, _, err := parseRawSSHPrivateKey(privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key: %s", err)
+	}
+
+	return signer.PublicKey(), nil
+}
+
+// decryptSSHPrivateKey returns the private key as CircleCI needs it, unencrypted
+// Encrypted keys are decrypted in memory and PEM encoded again, in the PKCS#1 format for RSA,
+// SEC 1 for ECDSA and OpenSSH for Ed25519. Unencrypted keys are returned as they are
+func decryptSSHPrivateKey(privateKey, passphrase string) (string, error) {
+	key, encrypted, err := parseRawSSHPrivateKey(privateKey, passphrase)
+	if err != nil || !encrypted {
+		return privateKey, err
+	}
+
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return "", err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	case *ed25519.PrivateKey:
+		if block, err = ssh.MarshalPrivateKey(*k, ""); err != nil {
+			return "", err
+		}
+	case ed25519.PrivateKey:
+		if block, err = ssh.MarshalPrivateKey(k, ""); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported encrypted private key of type %T", key)
+	}
+
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// validateSSHPrivateKey checks the private key can be parsed, encrypted keys are checked with the passphrase in CustomizeDiff
+func validateSSHPrivateKey(i interface{}, keyName string) (warnings []string, errors []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", keyName)}
+	}
+
+	if _, err := parseSSHPrivateKey(v, ""); err != nil && err != errSSHKeyEncrypted {
+		return nil, []error{fmt.Errorf("%s: %s", keyName, err)}
+	}
+
+	return nil, nil
+}
+
 func resourceCircleCISSHKeyCreate(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
 	name := d.Get("project").(string)
 	hostname := d.Get("hostname").(string)
 	privateKey := d.Get("private_key").(string)
 
-	block, rest := pem.Decode([]byte(privateKey))
-	if len(rest) != 0 {
-		return fmt.Errorf("found %d stray bytes in private key", len(rest))
+	if algorithm, ok := d.GetOk("key_algorithm"); ok {
+		var err error
+		privateKey, err = generateSSHPrivateKey(algorithm.(string), d.Get("rsa_bits").(int))
+		if err != nil {
+			return err
+		}
 	}
 
-	privKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	pubKey, err := parseSSHPrivateKey(privateKey, d.Get("passphrase").(string))
 	if err != nil {
 		return err
 	}
 
-	pubKey, err := ssh.NewPublicKey(&privKey.PublicKey)
+	// only the decrypted key is sent to CircleCI, it is never written to the state
+	privateKey, err = decryptSSHPrivateKey(privateKey, d.Get("passphrase").(string))
 	if err != nil {
 		return err
 	}
 
-	err = providerClient.AddSSHKey(name, hostname, privateKey)
+	err = providerClient.AddSSHKey(ctx, name, hostname, privateKey)
 	if err != nil {
 		return err
 	}
 
-	fingerprint := ssh.FingerprintLegacyMD5(pubKey)
+	d.SetId(sshKeyID(name, hostname, ssh.FingerprintLegacyMD5(pubKey)))
 
-	d.SetId(fmt.Sprintf("%s|%s|%s", name, hostname, fingerprint))
-	d.Set("fingerprint", fingerprint)
+	if err := setPassphraseHash(d); err != nil {
+		return err
+	}
 
-	return nil
+	return setSSHPublicKey(d, pubKey)
+}
+
+// setPassphraseHash replaces the passphrase with its hash once the key has been sent to CircleCI
+func setPassphraseHash(d *schema.ResourceData) error {
+	passphrase := d.Get("passphrase").(string)
+	if passphrase == "" {
+		return nil
+	}
+
+	salt, err := newSecretSalt()
+	if err != nil {
+		return err
+	}
+	if err := d.Set("passphrase_salt", salt); err != nil {
+		return err
+	}
+
+	return d.Set("passphrase", hashSecret(salt, passphrase))
 }
 
 func resourceCircleCISSHKeyRead(d *schema.ResourceData, m interface{}) error {
+	providerClient := m.(*ProviderClient)
+
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutRead))
+	defer cancel()
+
+	name := d.Get("project").(string)
+	hostname := d.Get("hostname").(string)
+	fingerprint := d.Get("fingerprint").(string)
+	fingerprintSHA256 := d.Get("fingerprint_sha256").(string)
+
+	keys, err := providerClient.ListSSHKeys(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key.Hostname != hostname {
+			continue
+		}
+
+		// CircleCI only shows MD5 fingerprints, keys imported by their SHA256 fingerprint
+		// are found with their public key
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.PublicKey))
+		if err != nil {
+			pubKey = nil
+		}
+
+		if key.Fingerprint != fingerprint && (pubKey == nil || fingerprintSHA256 == "" || ssh.FingerprintSHA256(pubKey) != fingerprintSHA256) {
+			continue
+		}
+
+		d.SetId(sshKeyID(name, hostname, key.Fingerprint))
+		if pubKey != nil {
+			return setSSHPublicKey(d, pubKey)
+		}
+		return d.Set("fingerprint", key.Fingerprint)
+	}
+
+	log.Printf("[WARN] ssh key %s for %s not found in project %s, removing it from state", d.Id(), hostname, name)
+	d.SetId("")
+
 	return nil
 }
 
+// sshKeyID builds the ID of an ssh key, its project, hostname and fingerprint separated by |
+func sshKeyID(projectName, hostname, fingerprint string) string {
+	return fmt.Sprintf("%s|%s|%s", projectName, hostname, fingerprint)
+}
+
+// parseSSHKeyID splits an ssh key ID of the form project|hostname|fingerprint
+// The fingerprint is either the MD5 fingerprint shown by CircleCI, optionally prefixed with MD5:,
+// or the SHA256 fingerprint prefixed with SHA256: as shown by ssh-keygen -l
+func parseSSHKeyID(id string) (projectName, hostname, fingerprint string, err error) {
+	parts := strings.Split(id, "|")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid ssh key ID %q, expected project|hostname|fingerprint", id)
+	}
+
+	return parts[0], parts[1], strings.TrimPrefix(parts[2], "MD5:"), nil
+}
+
+func resourceCircleCISSHKeyImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	projectName, hostname, fingerprint, err := parseSSHKeyID(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.Set("project", projectName); err != nil {
+		return nil, err
+	}
+	if err := d.Set("hostname", hostname); err != nil {
+		return nil, err
+	}
+
+	// the MD5 fingerprint of keys imported by their SHA256 fingerprint is found by Read
+	fingerprintKey := "fingerprint"
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprintKey = "fingerprint_sha256"
+	}
+	if err := d.Set(fingerprintKey, fingerprint); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceCircleCISSHKeyDelete(d *schema.ResourceData, m interface{}) error {
 	providerClient := m.(*ProviderClient)
 
+	ctx, cancel := providerClient.withTimeout(d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
 	name := d.Get("project").(string)
 	hostname := d.Get("hostname").(string)
 	fingerprint := d.Get("fingerprint").(string)
 
-	err := providerClient.DeleteSSHKey(name, hostname, fingerprint)
-	if err != nil {
+	err := providerClient.DeleteSSHKey(ctx, name, hostname, fingerprint)
+	if err != nil && !errors.Is(err, circleciapi.ErrNotFound) {
 		return err
 	}
 